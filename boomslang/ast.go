@@ -0,0 +1,101 @@
+package boomslang
+
+type Ast interface {
+	Eval(env *BsEnv) BsValue
+	ShortName() string
+	Span() Span
+}
+
+type AstFunCall struct {
+	fun      Ast
+	args     []Ast
+	of       bool // written as 'fun of args', which binds looser than the infix operators
+	quantity bool // written as '3 seconds', the number is the only argument
+	spn      Span
+}
+
+func (node AstFunCall) ShortName() string { return "procedure" }
+func (node AstFunCall) Span() Span        { return node.spn }
+
+type AstIdent struct {
+	name string
+	spn  Span
+}
+
+func (node AstIdent) ShortName() string { return "name" }
+func (node AstIdent) Span() Span        { return node.spn }
+
+type AstLiteral struct {
+	value BsValue
+	spn   Span
+}
+
+func (node AstLiteral) ShortName() string { return node.value.PrettyPrint() }
+func (node AstLiteral) Span() Span        { return node.spn }
+
+type AstAssign struct {
+	lvalue Ast
+	rvalue Ast
+	spn    Span
+}
+
+func (node AstAssign) ShortName() string { return "assignment" }
+func (node AstAssign) Span() Span        { return node.spn }
+
+type AstIfStmnt struct {
+	cond       Ast
+	if_block   []Ast
+	else_block []Ast
+	spn        Span
+	otherwise  Span // where the 'otherwise' line was, if there is one
+}
+
+func (node AstIfStmnt) ShortName() string { return "if statement" }
+func (node AstIfStmnt) Span() Span        { return node.spn }
+
+type AstLoop struct {
+	cond  Ast
+	block []Ast
+	// todo: loops in python are weirder than this
+	else_block []Ast
+	spn        Span
+	otherwise  Span
+}
+
+func (node AstLoop) ShortName() string { return "loop" }
+func (node AstLoop) Span() Span        { return node.spn }
+
+type AstBreak struct {
+	returns Ast
+	spn     Span
+}
+
+func (node AstBreak) ShortName() string { return "break" }
+func (node AstBreak) Span() Span        { return node.spn }
+
+type AstFuncDef struct {
+	name   AstIdent
+	params []AstIdent
+	body   []Ast
+	spn    Span
+}
+
+func (node AstFuncDef) ShortName() string { return "procedure definition for '" + node.name.name + "'" }
+func (node AstFuncDef) Span() Span        { return node.spn }
+
+type AstReturns struct {
+	expr Ast
+	spn  Span
+}
+
+func (node AstReturns) ShortName() string { return "returns" }
+func (node AstReturns) Span() Span        { return node.spn }
+
+type AstBorrow struct {
+	name AstIdent // the namespace the names of the module end up under
+	path Ast
+	spn  Span
+}
+
+func (node AstBorrow) ShortName() string { return "borrow" }
+func (node AstBorrow) Span() Span        { return node.spn }
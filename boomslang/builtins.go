@@ -0,0 +1,433 @@
+package boomslang
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Methods on this are called to initialize the name space bindings on compiler intrinsics
+// This is done to keep all of the definitions for a builtin in 1 spot
+type BuiltinRegistry struct{}
+
+// Called to before entering the runtime
+func LoadBuiltins(env *BsEnv) {
+	// the builtins and the standard library get a scope of their own above the globals,
+	// loading them again (like :reset does) swaps that scope out
+	if env.parent != nil && env.parent.library {
+		env.parent = env.parent.parent
+	}
+	library := env.insertParent()
+	library.library = true
+
+	registryV := BuiltinRegistry{}
+	registryT := reflect.TypeOf(registryV)
+	for i := 0; i < registryT.NumMethod(); i += 1 {
+		method := registryT.Method(i)
+		if env.debug {
+			log.Printf("calling %s\n", method.Name)
+		}
+		regFunc := method.Func.Interface().(func(BuiltinRegistry, *BsEnv))
+		regFunc(registryV, library)
+	}
+	loadStdlib(library)
+}
+
+// Binds the command line arguments that were forwarded to the program
+func LoadArguments(env *BsEnv, args []string) {
+	items := make([]BsValue, len(args))
+	for i, arg := range args {
+		items[i] = BsStrVal{value: arg}
+	}
+	env.AssignName("arguments", BsListVal{items: items})
+}
+
+// ==========================================
+//
+//	show operator:
+//	  prints each argument
+//	  and returns nil
+type BsBuiltinShow struct{}
+
+func (this BsBuiltinShow) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure 'show'>")
+}
+func (this BsBuiltinShow) Call(env *BsEnv, args []BsValue) BsValue {
+	for i, arg := range args {
+		if i != 0 {
+			fmt.Fprintf(env.ostr, " ")
+		}
+		fmt.Fprintf(env.ostr, "%s", arg.PrettyPrint())
+	}
+	fmt.Fprintf(env.ostr, "\n")
+	return new(BsNilVal)
+}
+func (r BuiltinRegistry) RegisterShow(env *BsEnv) {
+	env.provide(CAP_CONSOLE_OUTPUT, "show", BsFunVal{thunk: BsBuiltinShow{}})
+}
+
+// ==========================================
+//
+//	debug operator:
+//	  prints argument representation
+//	  and returns the first
+type BsBuiltinDebug struct{}
+
+func (this BsBuiltinDebug) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure 'debug'>")
+}
+func (this BsBuiltinDebug) Call(env *BsEnv, args []BsValue) BsValue {
+	for _, arg := range args {
+		fmt.Fprintf(env.ostr, "%v\n", arg)
+	}
+	if len(args) == 0 {
+		return new(BsNilVal)
+	}
+	return args[0]
+}
+
+func (r BuiltinRegistry) RegisterDebug(env *BsEnv) {
+	env.provide(CAP_CONSOLE_OUTPUT, "debug", BsFunVal{thunk: BsBuiltinDebug{}})
+}
+
+// ==========================================
+//
+//	ask and ask for a number
+//	  print the prompt and wait for a line of input.
+//	  ask of the default and text prompt gives back the default for an empty line,
+//	  ask for a number asks again until it gets one.
+//	  returns nothing once the input runs out
+type BsBuiltinAsk struct {
+	number bool
+}
+
+func (this BsBuiltinAsk) PrettyPrint() string {
+	if this.number {
+		return fmt.Sprintf("<builtin procedure 'ask for a number'>")
+	}
+	return fmt.Sprintf("<builtin procedure 'ask'>")
+}
+func (this BsBuiltinAsk) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) > 2 {
+		return BsMethodErr{expected: fmt.Sprintf("at most 2 parameters to %s, got %d", this.PrettyPrint(), len(args))}
+	}
+	var fallback BsValue
+	prompt := ""
+	if len(args) == 2 {
+		fallback = args[0]
+		prompt = fmt.Sprintf("%s [%s]", args[1].PrettyPrint(), fallback.PrettyPrint())
+	} else if len(args) == 1 {
+		prompt = args[0].PrettyPrint()
+	}
+	if this.number && fallback != nil {
+		if _, ok := fallback.(BsIntVal); !ok {
+			return BsTypeErr{expected: "number", value: fallback}
+		}
+	}
+
+	for {
+		if prompt != "" {
+			fmt.Fprintf(env.ostr, "%s ", prompt)
+		}
+		line, failure, err := readLimitedLine(env)
+		if failure != nil {
+			return failure
+		}
+		if err != nil && err != io.EOF {
+			return BsIoErr{msg: err.Error()}
+		}
+		if err == io.EOF && line == "" {
+			return BsNilVal{}
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" && fallback != nil {
+			return fallback
+		}
+		if !this.number {
+			return BsStrVal{value: line}
+		}
+		value, convErr := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+		if convErr == nil {
+			return BsIntVal{value: value}
+		}
+		if err == io.EOF {
+			return BsNilVal{}
+		}
+		fmt.Fprintf(env.ostr, "Sorry, but '%s' is not a number, please try again.\n", line)
+	}
+}
+
+// reads up to and including the next newline from the input,
+// giving up as soon as the line is longer than a text can be
+func readLimitedLine(env *BsEnv) (string, BsValue, error) {
+	b := new(strings.Builder)
+	for {
+		chunk, err := env.program.input.ReadSlice('\n')
+		if failure := env.program.budget.canMakeText(b.Len() + len(bytes.TrimRight(chunk, "\r\n"))); failure != nil {
+			return "", failure, nil
+		}
+		b.Write(chunk)
+		if err != bufio.ErrBufferFull {
+			return b.String(), nil, err
+		}
+	}
+}
+
+func (r BuiltinRegistry) RegisterAsk(env *BsEnv) {
+	env.provide(CAP_CONSOLE_INPUT, "ask", BsFunVal{thunk: BsBuiltinAsk{}})
+	env.provide(CAP_CONSOLE_INPUT, "ask for a number", BsFunVal{thunk: BsBuiltinAsk{number: true}})
+}
+
+// ==========================================
+//
+//	environment
+//	  looks up an environment variable by name
+//	  returns nothing if it is not set
+func (r BuiltinRegistry) RegisterEnvironment(env *BsEnv) {
+	env.provide(CAP_ENVIRONMENT, "environment", MustWrapFunc("environment", func(name string) any {
+		value, found := os.LookupEnv(name)
+		if !found {
+			return nil
+		}
+		return value
+	}))
+}
+
+// ==========================================
+//
+//	exit
+//	  stops the program right away
+//	  with the given status code (or 0)
+type BsBuiltinExit struct{}
+
+func (this BsBuiltinExit) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure 'exit'>")
+}
+func (this BsBuiltinExit) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) > 1 {
+		return BsMethodErr{expected: fmt.Sprintf("at most 1 parameter to %s, got %d", this.PrettyPrint(), len(args))}
+	}
+	if len(args) == 0 {
+		return BsExitExc{code: 0}
+	}
+	code, ok := args[0].(BsIntVal)
+	if !ok {
+		return BsTypeErr{expected: "status code", value: args[0]}
+	}
+	return BsExitExc{code: int(code.value)}
+}
+
+func (r BuiltinRegistry) RegisterExit(env *BsEnv) {
+	env.AssignName("exit", BsFunVal{thunk: BsBuiltinExit{}})
+}
+
+// ==========================================
+//
+//	list operations:
+//	  first, rest and length
+//	  enough to walk over a list with a loop
+type BsBuiltinFirst struct{}
+
+func (this BsBuiltinFirst) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure 'first'>")
+}
+func (this BsBuiltinFirst) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) != 1 {
+		return BsMethodErr{expected: fmt.Sprintf("1 parameter to %s, got %d", this.PrettyPrint(), len(args))}
+	}
+	list, ok := args[0].(BsListVal)
+	if !ok || len(list.items) == 0 {
+		return BsTypeErr{expected: "list with something in it", value: args[0]}
+	}
+	return list.items[0]
+}
+
+type BsBuiltinRest struct{}
+
+func (this BsBuiltinRest) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure 'rest'>")
+}
+func (this BsBuiltinRest) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) != 1 {
+		return BsMethodErr{expected: fmt.Sprintf("1 parameter to %s, got %d", this.PrettyPrint(), len(args))}
+	}
+	list, ok := args[0].(BsListVal)
+	if !ok {
+		return BsTypeErr{expected: "list", value: args[0]}
+	}
+	if len(list.items) == 0 {
+		return list
+	}
+	return BsListVal{items: list.items[1:]}
+}
+
+type BsBuiltinLength struct{}
+
+func (this BsBuiltinLength) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure 'length'>")
+}
+func (this BsBuiltinLength) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) != 1 {
+		return BsMethodErr{expected: fmt.Sprintf("1 parameter to %s, got %d", this.PrettyPrint(), len(args))}
+	}
+	switch v := args[0].(type) {
+	case BsListVal:
+		return BsIntVal{value: int64(len(v.items))}
+	case BsStrVal:
+		return BsIntVal{value: int64(len([]rune(v.value)))}
+	}
+	return BsTypeErr{expected: "list or text", value: args[0]}
+}
+
+func (r BuiltinRegistry) RegisterListOperations(env *BsEnv) {
+	env.AssignName("first", BsFunVal{thunk: BsBuiltinFirst{}})
+	env.AssignName("rest", BsFunVal{thunk: BsBuiltinRest{}})
+	env.AssignName("length", BsFunVal{thunk: BsBuiltinLength{}})
+}
+
+// ==========================================
+//
+//	text operations:
+//	  characters and together
+//	  enough to take text apart and put it back together in the standard library
+func (r BuiltinRegistry) RegisterTextOperations(env *BsEnv) {
+	env.AssignName("characters", MustWrapFunc("characters", func(env *BsEnv, value string) BsValue {
+		if failure := env.program.budget.canMakeList(utf8.RuneCountInString(value)); failure != nil {
+			return failure
+		}
+		items := []BsValue{}
+		for _, letter := range strings.Split(value, "") {
+			items = append(items, BsStrVal{value: letter})
+		}
+		return BsListVal{items: items}
+	}))
+	env.AssignName("together", MustWrapFunc("together", func(env *BsEnv, left string, right string) BsValue {
+		if failure := env.program.budget.canMakeText(len(left) + len(right)); failure != nil {
+			return failure
+		}
+		return BsStrVal{value: left + right}
+	}))
+}
+
+// ==========================================
+//
+//	casts: take an arbitrary object
+//	  return that as the correct type
+type BsBuiltinCastToInt struct{}
+
+func (this BsBuiltinCastToInt) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure 'number'>")
+}
+func (this BsBuiltinCastToInt) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) != 1 {
+		return BsMethodErr{expected: fmt.Sprintf("1 parameter to %s, got %d", this.PrettyPrint(), len(args))}
+	}
+	switch v := args[0].(type) {
+	case BsIntVal:
+		return args[0]
+	case BsStrVal:
+		var value int64
+		n, err := fmt.Sscanf(v.value, "%d", &value)
+		if err != nil || n == 0 {
+			return BsTypeErr{expected: "text with a number", value: v}
+		}
+		return BsIntVal{value}
+	}
+	return BsTypeErr{expected: "something I can turn into a number", value: args[0]}
+}
+
+func (r BuiltinRegistry) RegisterCastToInt(env *BsEnv) {
+	env.AssignName("number", BsFunVal{thunk: BsBuiltinCastToInt{}})
+}
+
+// ==========================================
+//
+//	binary integer operations:
+//	  take 2 integers and returns a third
+type BsBuiltinIntBinOp struct {
+	name string
+	op   func(int64, int64) int64
+}
+
+func makeIntBinOp(name string, op func(int64, int64) int64) BsFunVal {
+	thunk := BsBuiltinIntBinOp{
+		name: name,
+		op:   op,
+	}
+	fun := BsFunVal{thunk: thunk}
+	return fun
+}
+func (this BsBuiltinIntBinOp) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure '%s'>", this.name)
+}
+func (this BsBuiltinIntBinOp) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) != 2 {
+		return BsMethodErr{expected: "2 parameters"}
+	}
+	left, ok := args[0].(BsIntVal)
+	if !ok {
+		return BsTypeErr{expected: "number", value: args[0]}
+	}
+	right, ok := args[1].(BsIntVal)
+	if !ok {
+		return BsTypeErr{expected: "number", value: args[1]}
+	}
+	value := this.op(left.value, right.value)
+	return BsIntVal{value: value}
+}
+
+func (r BuiltinRegistry) RegisterIntegerBinaryOperations(env *BsEnv) {
+	env.AssignName("_super-duper-secret__plus", makeIntBinOp("plus", func(x, y int64) int64 { return x + y }))
+	env.AssignName("_super-duper-secret__minus", makeIntBinOp("minus", func(x, y int64) int64 { return x - y }))
+	env.AssignName("_super-duper-secret__multiply", makeIntBinOp("multiply", func(x, y int64) int64 { return x * y }))
+	env.AssignName("_super-duper-secret__divide", makeIntBinOp("divide", func(x, y int64) int64 { return x / y }))
+}
+
+// ==========================================
+//
+//	binary integer predicates:
+//	  take 2 integers and returns a boole
+type BsBuiltinIntBinPred struct {
+	name string
+	op   func(int64, int64) bool
+}
+
+func makeIntBinPred(name string, op func(int64, int64) bool) BsFunVal {
+	thunk := BsBuiltinIntBinPred{
+		name: name,
+		op:   op,
+	}
+	fun := BsFunVal{thunk: thunk}
+	return fun
+}
+func (this BsBuiltinIntBinPred) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure '%s'>", this.name)
+}
+func (this BsBuiltinIntBinPred) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) != 2 {
+		return BsMethodErr{expected: "2 parameters"}
+	}
+	left, ok := args[0].(BsIntVal)
+	if !ok {
+		return BsTypeErr{expected: "number", value: args[0]}
+	}
+	right, ok := args[1].(BsIntVal)
+	if !ok {
+		return BsTypeErr{expected: "number", value: args[1]}
+	}
+	value := this.op(left.value, right.value)
+	return BsBooleVal{value: value}
+}
+
+func (r BuiltinRegistry) RegisterIntBinPred(env *BsEnv) {
+	env.AssignName("_super-duper-secret__smallerthan", makeIntBinPred("smallerthan", func(x, y int64) bool { return x < y }))
+	env.AssignName("_super-duper-secret__biggerthan", makeIntBinPred("biggerthan", func(x, y int64) bool { return x > y }))
+	env.AssignName("_super-duper-secret__equals", makeIntBinPred("equals", func(x, y int64) bool { return x == y }))
+}
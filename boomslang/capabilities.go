@@ -0,0 +1,106 @@
+package boomslang
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Capabilities: builtins that reach outside the program are tagged with what they reach for.
+// A program only gets the builtins whose capability it is allowed,
+// the others are left out and looking them up says they were withheld by policy
+
+type Capability uint
+
+const (
+	CAP_CONSOLE_INPUT Capability = 1 << iota
+	CAP_CONSOLE_OUTPUT
+	CAP_FILESYSTEM
+	CAP_ENVIRONMENT
+	CAP_CLOCK
+	CAP_RANDOMNESS
+	CAP_NETWORK
+)
+const CAP_ALL Capability = CAP_CONSOLE_INPUT | CAP_CONSOLE_OUTPUT | CAP_FILESYSTEM | CAP_ENVIRONMENT | CAP_CLOCK | CAP_RANDOMNESS | CAP_NETWORK
+
+// what a sandboxed program is allowed when nobody picked anything else
+const SANDBOX_CAPABILITIES Capability = CAP_CONSOLE_OUTPUT | CAP_RANDOMNESS
+
+// the name --allow knows a capability by, and how errors describe it
+var capabilityNames = []struct {
+	capability  Capability
+	flag        string
+	description string
+}{
+	{CAP_CONSOLE_INPUT, "input", "console input"},
+	{CAP_CONSOLE_OUTPUT, "output", "console output"},
+	{CAP_FILESYSTEM, "filesystem", "the file system"},
+	{CAP_ENVIRONMENT, "environment", "environment variables"},
+	{CAP_CLOCK, "clock", "the clock"},
+	{CAP_RANDOMNESS, "randomness", "randomness"},
+	{CAP_NETWORK, "network", "the network"},
+}
+
+func (c Capability) String() string {
+	described := make([]string, 0, len(capabilityNames))
+	for _, name := range capabilityNames {
+		if c&name.capability != 0 {
+			described = append(described, name.description)
+		}
+	}
+	if len(described) == 0 {
+		return "nothing"
+	}
+	return strings.Join(described, ", ")
+}
+
+// a list like input,output, or all or none
+func parseCapabilities(list string) (Capability, error) {
+	if list == "all" {
+		return CAP_ALL, nil
+	}
+	var capabilities Capability
+	if list == "none" {
+		return capabilities, nil
+	}
+	for _, elem := range strings.Split(list, ",") {
+		found := false
+		for _, name := range capabilityNames {
+			if elem == name.flag {
+				capabilities |= name.capability
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("'%s' not supported", elem)
+		}
+	}
+	return capabilities, nil
+}
+
+// the capabilities programs started with opts do not get
+func (opts *Opts) withheld() Capability {
+	if opts.hasAllow {
+		return CAP_ALL &^ opts.allow
+	}
+	if opts.sandbox {
+		return CAP_ALL &^ SANDBOX_CAPABILITIES
+	}
+	return 0
+}
+
+// how failures describe something a program was not allowed
+func withheldByPolicy(what string, capability Capability) string {
+	return fmt.Sprintf("%s was withheld by policy, this program is not allowed to use %s", what, capability)
+}
+
+// makes a builtin that needs capability, unless the program is not allowed it
+func (env *BsEnv) provide(capability Capability, name string, value BsValue) {
+	if env.program.withheld&capability != 0 {
+		if env.withheld == nil {
+			env.withheld = make(map[string]Capability)
+		}
+		env.withheld[name] = capability
+		return
+	}
+	env.AssignName(name, value)
+}
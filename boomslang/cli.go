@@ -0,0 +1,362 @@
+package boomslang
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EXIT_BAD_OPTS int = 10 + iota
+	EXIT_BAD_FILE
+	EXIT_LEX_FAILURE
+	EXIT_PARSE_FAILURE
+	EXIT_RUNTIME_FAILURE
+	EXIT_NOT_FORMATTED
+	EXIT_LINT_WARNINGS
+)
+
+type DebugTarget int
+
+const (
+	DBG_PRE DebugTarget = 1 << iota
+	DBG_LEX
+	DBG_PARSE
+	DBG_EVAL
+)
+const DBG_ALL DebugTarget = ^0
+
+type Opts struct {
+	debug       DebugTarget
+	istr        io.Reader
+	ostr        io.Writer
+	estr        io.Writer
+	filePath    string
+	args        []string // forwarded to the program as 'the arguments'
+	inline      string   // program text given with -e
+	hasInline   bool
+	anyExt      bool     // run files even if they do not end in .bs
+	trace       string   // file to write a record of every statement to, - for stderr
+	traceFormat string   // TRACE_TEXT or TRACE_JSON
+	defines     []string // names #if defined holds for
+	limits      evalLimits
+	sandbox     bool       // limits for everything and no builtins that reach outside the program
+	allow       Capability // what builtins may reach for, when hasAllow
+	hasAllow    bool
+	seed        int64 // where random starts from, when hasSeed
+	hasSeed     bool
+	clock       Clock // nil for the system clock
+}
+
+func parse_opts(args []string) *Opts {
+	opts := new(Opts)
+
+	positional := make([]string, 0, len(args))
+
+	for i := 0; i < len(args); i += 1 {
+		arg := args[i]
+		if arg == "--" {
+			// everything after this belongs to the program
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if arg == "-e" {
+			if i+1 >= len(args) {
+				fmt.Printf("Bad flag: -e needs some code to run\n")
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.inline = args[i+1]
+			opts.hasInline = true
+			i += 1
+			continue
+		}
+		if !strings.HasPrefix(arg, "--") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		// start: parsing the arg
+		if arg == "--any-extension" {
+			opts.anyExt = true
+		} else if arg == "--debug" {
+			opts.debug = DBG_ALL
+		} else if strings.HasPrefix(arg, "--debug=") {
+			targets, err := parseDebugTargets(strings.TrimPrefix(arg, "--debug="))
+			if err != nil {
+				fmt.Printf("Bad choice for --debug, %v\n", err)
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.debug |= targets
+		} else if strings.HasPrefix(arg, "--define=") {
+			opts.defines = append(opts.defines, strings.TrimPrefix(arg, "--define="))
+		} else if strings.HasPrefix(arg, "--max-steps=") {
+			steps, err := strconv.ParseInt(strings.TrimPrefix(arg, "--max-steps="), 10, 64)
+			if err != nil || steps < 0 {
+				fmt.Printf("Bad choice for --max-steps, it needs a number of steps\n")
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.limits.maxSteps = steps
+		} else if strings.HasPrefix(arg, "--max-depth=") {
+			depth, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-depth="))
+			if err != nil || depth < 1 {
+				fmt.Printf("Bad choice for --max-depth, it needs a number of calls\n")
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.limits.maxDepth = depth
+		} else if strings.HasPrefix(arg, "--max-text=") {
+			length, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-text="))
+			if err != nil || length < 0 {
+				fmt.Printf("Bad choice for --max-text, it needs a number of letters\n")
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.limits.maxText = length
+		} else if strings.HasPrefix(arg, "--max-items=") {
+			items, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-items="))
+			if err != nil || items < 0 {
+				fmt.Printf("Bad choice for --max-items, it needs a number of items\n")
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.limits.maxItems = items
+		} else if strings.HasPrefix(arg, "--max-names=") {
+			names, err := strconv.Atoi(strings.TrimPrefix(arg, "--max-names="))
+			if err != nil || names < 0 {
+				fmt.Printf("Bad choice for --max-names, it needs a number of names\n")
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.limits.maxNames = names
+		} else if strings.HasPrefix(arg, "--allow=") {
+			allow, err := parseCapabilities(strings.TrimPrefix(arg, "--allow="))
+			if err != nil {
+				fmt.Printf("Bad choice for --allow, %v\n", err)
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.allow = allow
+			opts.hasAllow = true
+		} else if strings.HasPrefix(arg, "--seed=") {
+			seed, err := strconv.ParseInt(strings.TrimPrefix(arg, "--seed="), 10, 64)
+			if err != nil {
+				fmt.Printf("Bad choice for --seed, it needs a number\n")
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.seed = seed
+			opts.hasSeed = true
+		} else if arg == "--sandbox" {
+			opts.sandbox = true
+		} else if strings.HasPrefix(arg, "--timeout=") {
+			timeout, err := time.ParseDuration(strings.TrimPrefix(arg, "--timeout="))
+			if err != nil || timeout < 0 {
+				fmt.Printf("Bad choice for --timeout, it needs a duration like 10s\n")
+				os.Exit(EXIT_BAD_OPTS)
+			}
+			opts.limits.timeout = timeout
+		} else if strings.HasPrefix(arg, "--trace=") {
+			opts.trace = strings.TrimPrefix(arg, "--trace=")
+		} else if strings.HasPrefix(arg, "--trace-format=") {
+			opts.traceFormat = strings.TrimPrefix(arg, "--trace-format=")
+			if opts.traceFormat != TRACE_TEXT && opts.traceFormat != TRACE_JSON {
+				fmt.Printf("Bad choice for --trace-format, pick %s or %s\n", TRACE_TEXT, TRACE_JSON)
+				os.Exit(EXIT_BAD_OPTS)
+			}
+		} else {
+			fmt.Printf("Bad flag: I do not recognize %s\n", arg)
+			os.Exit(EXIT_BAD_OPTS)
+		}
+
+		//end: parsing the flag args
+
+	}
+
+	// use the postional args:
+	// the first one is the program, the rest are handed to it
+	// (unless the program was given inline, then they are all handed over)
+	if opts.hasInline {
+		opts.args = positional
+	} else if len(positional) >= 1 {
+		opts.filePath = positional[0]
+		opts.args = positional[1:]
+	}
+
+	// set good defaults for other args
+	return withStdStreams(opts)
+}
+
+func withStdStreams(opts *Opts) *Opts {
+	opts.istr = os.Stdin
+	opts.ostr = os.Stdout
+	opts.estr = os.Stderr
+	return opts
+}
+
+// tools that are not about running a program, picked by the first argument
+var subcommands = map[string]func(opts *Opts, args []string) int{
+	"dap":   runDap,
+	"debug": runDebug,
+	"fmt":   runFmt,
+	"lint":  runLint,
+	"lsp":   runLsp,
+}
+
+// turns a list like "lex,eval" into the matching debug targets
+func parseDebugTargets(list string) (DebugTarget, error) {
+	var targets DebugTarget
+	for _, elem := range strings.Split(list, ",") {
+		if elem == "pre" {
+			targets |= DBG_PRE
+		} else if elem == "lex" {
+			targets |= DBG_LEX
+		} else if elem == "parse" {
+			targets |= DBG_PARSE
+		} else if elem == "eval" {
+			targets |= DBG_EVAL
+		} else {
+			return 0, fmt.Errorf("'%s' not supported", elem)
+		}
+	}
+	return targets, nil
+}
+
+// Runs the boomslang command line with args (without the name of the binary),
+// the result is the exit status
+func Main(args []string) int {
+	log.SetFlags(log.Lshortfile | log.LstdFlags)
+
+	if len(args) > 0 {
+		if command, ok := subcommands[args[0]]; ok {
+			return command(withStdStreams(new(Opts)), args[1:])
+		}
+	}
+
+	opts := parse_opts(args)
+	if opts.debug > 0 {
+		log.Printf("debug mode, good choice...\n")
+	}
+	if opts.hasInline {
+		return executeSource(opts, MakeReaderSource("<inline>", strings.NewReader(opts.inline)))
+	}
+	if opts.filePath != "" {
+		return execute(opts, opts.filePath)
+	}
+	return repl(opts)
+}
+
+type FileSource struct {
+	filePath string
+	buf      *bufio.Reader
+}
+
+func (s FileSource) Name() string {
+	return s.filePath
+}
+func (s FileSource) ReadLine() (string, error) {
+	return readLine(s.buf)
+}
+
+// A program coming from anywhere else, like stdin or the command line
+type ReaderSource struct {
+	name string
+	buf  *bufio.Reader
+}
+
+func MakeReaderSource(name string, r io.Reader) ReaderSource {
+	return ReaderSource{name: name, buf: bufio.NewReader(r)}
+}
+func (s ReaderSource) Name() string {
+	return s.name
+}
+func (s ReaderSource) ReadLine() (string, error) {
+	return readLine(s.buf)
+}
+
+// reads up to and including the next newline.
+// a last line without one is still a line, EOF is reported on the next read
+func readLine(buf *bufio.Reader) (string, error) {
+	line, err := buf.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		return line, nil
+	}
+	return line, err
+}
+
+func execute(opts *Opts, filePath string) int {
+	if filePath == "-" {
+		return executeSource(opts, MakeReaderSource("<stdin>", opts.istr))
+	}
+	// Open the file in read-only mode
+	file, err := os.OpenFile(filePath, os.O_RDONLY, 0444)
+	if err != nil {
+		fmt.Fprintf(opts.estr, "Error opening file '%s': %s\n", filePath, err)
+		return (EXIT_BAD_FILE)
+	}
+	defer file.Close()
+	buf := bufio.NewReader(file)
+
+	// scripts started through a shebang can be called whatever they like
+	if !strings.HasSuffix(filePath, ".bs") && !opts.anyExt && !hasShebang(buf) {
+		fmt.Fprintf(opts.estr, "Bad file extension, '%s' does not look like a boomslang file.\n", filePath)
+		return (EXIT_BAD_FILE)
+	}
+
+	source := FileSource{filePath, buf}
+
+	return executeSource(opts, source)
+}
+
+func hasShebang(buf *bufio.Reader) bool {
+	start, err := buf.Peek(2)
+	return err == nil && string(start) == "#!"
+}
+
+func executeSource(opts *Opts, source Source) int {
+	// evaluate the program
+	env := MakeEnv(opts)
+	LoadBuiltins(env)
+	LoadArguments(env, opts.args)
+
+	finishTrace, err := attachTrace(opts, env)
+	if err != nil {
+		fmt.Fprintf(opts.estr, "Error opening file '%s': %s\n", opts.trace, err)
+		return EXIT_BAD_FILE
+	}
+	done := env.limit(context.Background(), opts.evalLimits())
+	rc, _ := run(opts, source, env)
+	done()
+	finishTrace()
+	return rc
+}
+
+func run(opts *Opts, source Source, env *BsEnv) (int, BsValue) {
+	lexer := MakeLexer(opts, MakePreprocessor(opts, source))
+	tokens, err := lexer.Lex()
+	if err != nil {
+		fmt.Fprintf(opts.estr, "\033[0;31m I am very sorry, but I could not understand this file due to: %v\n\033[0m ", err)
+		return EXIT_LEX_FAILURE, nil
+	}
+
+	parser := MakeParser(opts, tokens)
+	ast, err := parser.Parse()
+	if err != nil {
+		fmt.Fprintf(opts.estr, "\033[0;31m I am sorry, but I simply could not understand the file you gave me: %v\n\033[0m ", err)
+		return EXIT_PARSE_FAILURE, nil
+	}
+
+	if opts.debug != 0 {
+		fmt.Fprintf(opts.ostr, "============================ BEGIN EVAL ===========================\n")
+	}
+
+	val := EvalAll(env, ast)
+	if exit, ok := unwindCause(val).(BsExitExc); ok {
+		return exit.code, BsNilVal{}
+	}
+	if val.ShouldUnwind() {
+		fmt.Fprintf(opts.estr, "\033[0;31m Failure occured during runtime:\n%v\033[0m\n", val.PrettyPrint())
+		return EXIT_RUNTIME_FAILURE, val
+	}
+
+	return 0, val
+}
@@ -0,0 +1,196 @@
+package boomslang
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Builtins for dates and times. A moment is a number of seconds since the start of 1970
+// and a duration is a number of seconds, so plus and minus do date arithmetic.
+// Formats are written with words like 'weekday, day month year at hour:minute'
+
+// Where the clock builtins get the time from, Options.Clock swaps it for a fake one
+type Clock interface {
+	Now() time.Time
+	// returns early with the context's error when ctx is done first
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+func (systemClock) Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newClock(opts *Opts) Clock {
+	if opts.clock != nil {
+		return opts.clock
+	}
+	return systemClock{}
+}
+
+// the words formats are written with, and what they are in a Go layout
+var formatWords = map[string]string{
+	"year":    "2006",
+	"month":   "January",
+	"day":     "2",
+	"weekday": "Monday",
+	"hour":    "15",
+	"minute":  "04",
+	"second":  "05",
+}
+
+var formatWord = regexp.MustCompile(`[a-z]+`)
+
+// everything in format that is not one of the formatWords stays as it is
+func layoutOf(format string) string {
+	return formatWord.ReplaceAllStringFunc(format, func(word string) string {
+		if layout, ok := formatWords[word]; ok {
+			return layout
+		}
+		return word
+	})
+}
+
+// ==========================================
+//
+//	now
+//	  returns the moment it is right now
+func (r BuiltinRegistry) RegisterNow(env *BsEnv) {
+	env.provide(CAP_CLOCK, "now", MustWrapFunc("now", func(env *BsEnv) int64 {
+		return env.program.clock.Now().Unix()
+	}))
+}
+
+// ==========================================
+//
+//	seconds, minutes, hours, days and weeks
+//	  return how many seconds there are in that many of them,
+//	  written as a quantity like '3 days'
+func (r BuiltinRegistry) RegisterDurations(env *BsEnv) {
+	units := []struct {
+		name   string
+		length time.Duration
+	}{
+		{"seconds", time.Second},
+		{"minutes", time.Minute},
+		{"hours", time.Hour},
+		{"days", 24 * time.Hour},
+		{"weeks", 7 * 24 * time.Hour},
+	}
+	for _, unit := range units {
+		seconds := int64(unit.length / time.Second)
+		name := unit.name
+		env.provide(CAP_CLOCK, name, MustWrapFunc(name, func(count int64) (int64, error) {
+			if count > math.MaxInt64/seconds || count < math.MinInt64/seconds {
+				return 0, fmt.Errorf("%d %s are more seconds than a number can hold", count, name)
+			}
+			return count * seconds, nil
+		}))
+	}
+}
+
+// ==========================================
+//
+//	duration
+//	  returns a number of seconds as text, like '1 hour 20 minutes'
+func (r BuiltinRegistry) RegisterDuration(env *BsEnv) {
+	env.provide(CAP_CLOCK, "duration", MustWrapFunc("duration", func(seconds int64) string {
+		return describeDuration(seconds)
+	}))
+}
+
+func describeDuration(seconds int64) string {
+	sign := ""
+	if seconds < 0 {
+		sign, seconds = "minus ", -seconds
+	}
+	parts := []string{}
+	for _, unit := range []struct {
+		name   string
+		length int64
+	}{{"day", 86400}, {"hour", 3600}, {"minute", 60}, {"second", 1}} {
+		count := seconds / unit.length
+		seconds -= count * unit.length
+		if count == 1 {
+			parts = append(parts, "1 "+unit.name)
+		} else if count > 1 {
+			parts = append(parts, fmt.Sprintf("%d %ss", count, unit.name))
+		}
+	}
+	if len(parts) == 0 {
+		return "0 seconds"
+	}
+	return sign + strings.Join(parts, " ")
+}
+
+// ==========================================
+//
+//	format and timestamp
+//	  format writes a moment as text,
+//	  timestamp reads a moment from text written that way
+func (r BuiltinRegistry) RegisterFormat(env *BsEnv) {
+	env.provide(CAP_CLOCK, "format", MustWrapFunc("format", func(env *BsEnv, moment int64, format string) string {
+		return time.Unix(moment, 0).In(env.program.clock.Now().Location()).Format(layoutOf(format))
+	}))
+	env.provide(CAP_CLOCK, "timestamp", MustWrapFunc("timestamp", func(env *BsEnv, format string, text string) (int64, error) {
+		moment, err := time.ParseInLocation(layoutOf(format), text, env.program.clock.Now().Location())
+		if err != nil {
+			return 0, fmt.Errorf("'%s' is not written like '%s'", text, format)
+		}
+		return moment.Unix(), nil
+	}))
+}
+
+// ==========================================
+//
+//	wait and wait for
+//	  pause the program for a number of seconds,
+//	  as in 'wait for 3 seconds'
+type BsBuiltinWait struct {
+	name string
+}
+
+func (this BsBuiltinWait) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure '%s'>", this.name)
+}
+func (this BsBuiltinWait) Call(env *BsEnv, args []BsValue) BsValue {
+	if len(args) != 1 {
+		return BsMethodErr{expected: fmt.Sprintf("1 parameter to %s, got %d", this.PrettyPrint(), len(args))}
+	}
+	seconds, ok := args[0].(BsIntVal)
+	if !ok {
+		return BsTypeErr{expected: "number of seconds", value: args[0]}
+	}
+	// time.Duration counts nanoseconds, it runs out after about 292 years
+	if maxWait := int64(math.MaxInt64 / time.Second); seconds.value < 0 || seconds.value > maxWait {
+		return BsTypeErr{expected: fmt.Sprintf("number of seconds to wait, from 0 to %d", maxWait), value: seconds}
+	}
+	ctx := env.program.budget.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := env.program.clock.Sleep(ctx, time.Duration(seconds.value)*time.Second); err != nil {
+		return stopped(err)
+	}
+	return BsNilVal{}
+}
+
+func (r BuiltinRegistry) RegisterWait(env *BsEnv) {
+	env.provide(CAP_CLOCK, "wait", BsFunVal{thunk: BsBuiltinWait{name: "wait"}})
+	env.provide(CAP_CLOCK, "wait for", BsFunVal{thunk: BsBuiltinWait{name: "wait for"}})
+}
@@ -0,0 +1,77 @@
+package boomslang
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Converting between Go values and boomslang values, for programs that embed an Interpreter
+
+// Turns a Go value into a boomslang one: nil is nothing, bools are booles,
+// whole numbers are numbers, strings are text and slices or arrays are lists.
+// Boomslang values are handed back as they are
+func ToValue(value any) (BsValue, error) {
+	if value == nil {
+		return BsNilVal{}, nil
+	}
+	if v, ok := value.(BsValue); ok {
+		return v, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return BsBooleVal{value: rv.Bool()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return BsIntVal{value: rv.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("%d is too big to be a boomslang number", rv.Uint())
+		}
+		return BsIntVal{value: int64(rv.Uint())}, nil
+	case reflect.String:
+		return BsStrVal{value: rv.String()}, nil
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return BsListVal{items: []BsValue{}}, nil
+		}
+		items := make([]BsValue, rv.Len())
+		for i := range items {
+			item, err := ToValue(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return BsListVal{items: items}, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return BsNilVal{}, nil
+		}
+		return ToValue(rv.Elem().Interface())
+	}
+	return nil, fmt.Errorf("can not turn a %T into a boomslang value", value)
+}
+
+// Turns a boomslang value into a Go one: nothing is nil, booles are bools,
+// numbers are int64, text is a string and lists are []any.
+// Anything else (like procedures) is handed back as it is
+func FromValue(value BsValue) any {
+	switch v := value.(type) {
+	case BsNilVal, *BsNilVal:
+		return nil
+	case BsBooleVal:
+		return v.value
+	case BsIntVal:
+		return v.value
+	case BsStrVal:
+		return v.value
+	case BsListVal:
+		items := make([]any, len(v.items))
+		for i, item := range v.items {
+			items[i] = FromValue(item)
+		}
+		return items
+	}
+	return value
+}
@@ -0,0 +1,514 @@
+package boomslang
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Debug adapter: speaks DAP on stdin and stdout so editors can debug Boomslang programs.
+// The program runs on its own goroutine and follows along through an EvalHook,
+// whenever it has to stop it waits there until the editor tells it to go on.
+// There is only ever one thread, and lines count from 1 like they do everywhere else
+
+const DAP_THREAD int = 1
+
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// the arguments of every request we understand, each only uses a few of them
+type dapArguments struct {
+	Program     string   `json:"program"`
+	Args        []string `json:"args"`
+	StopOnEntry bool     `json:"stopOnEntry"`
+	Source      struct {
+		Path string `json:"path"`
+	} `json:"source"`
+	Breakpoints []struct {
+		Line int `json:"line"`
+	} `json:"breakpoints"`
+	FrameId            int    `json:"frameId"`
+	VariablesReference int    `json:"variablesReference"`
+	Expression         string `json:"expression"`
+}
+
+type dapSession struct {
+	opts *Opts
+	in   *bufio.Reader
+
+	writeMu sync.Mutex
+	out     io.Writer
+	seq     int
+
+	// set up by launch, the program is started by configurationDone
+	ast        []Ast
+	args       []string
+	launched   bool
+	configured bool
+	started    bool
+	done       chan int // the exit code, once the program finished
+
+	// the stepping state and breakpoints of the tracker are shared between
+	// the program and the editor, they are guarded by mu along with the rest of these
+	mu          sync.Mutex
+	pauseAsked  bool
+	terminating bool
+	paused      bool
+	resume      chan bool
+	absPaths    map[string]string
+
+	// the stack is only touched by whoever is running:
+	// the program, or the editor while the program is paused
+	debugTracker
+	handles []any // *BsEnv or BsListVal behind each variablesReference
+}
+
+func makeDapSession(opts *Opts) *dapSession {
+	d := new(dapSession)
+	d.opts = opts
+	d.in = bufio.NewReader(opts.istr)
+	d.out = opts.ostr
+	d.breakpoints = make(map[string]map[int]bool)
+	d.resume = make(chan bool, 1)
+	d.absPaths = make(map[string]string)
+	return d
+}
+
+// ==========================================
+//
+//	boomslang dap
+//	  serves one debugging session on stdin and stdout
+func runDap(opts *Opts, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(opts.estr, "Bad flag: I do not recognize %s\n", args[0])
+		return EXIT_BAD_OPTS
+	}
+	return makeDapSession(opts).serve()
+}
+
+func (d *dapSession) serve() int {
+	for {
+		body, err := readFrame(d.in)
+		if err == io.EOF {
+			d.terminate()
+			return 0
+		}
+		var msg dapMessage
+		if err == nil {
+			err = json.Unmarshal(body, &msg)
+		}
+		if err != nil {
+			d.event("output", map[string]any{"category": "console", "output": "bad message: " + err.Error() + "\n"})
+			continue
+		}
+		if msg.Type != "request" {
+			continue
+		}
+		if d.handle(msg) {
+			return 0
+		}
+	}
+}
+
+func (d *dapSession) write(msg dapMessage) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	d.seq += 1
+	msg.Seq = d.seq
+	body, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	writeFrame(d.out, body)
+}
+
+func (d *dapSession) respond(req dapMessage, body any) {
+	success := true
+	raw, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	d.write(dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Body: raw})
+}
+
+func (d *dapSession) fail(req dapMessage, format string, args ...any) {
+	success := false
+	d.write(dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *dapSession) event(event string, body any) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	d.write(dapMessage{Type: "event", Event: event, Body: raw})
+}
+
+// handles one request, returns whether the session is over
+func (d *dapSession) handle(req dapMessage) bool {
+	var args dapArguments
+	if len(req.Arguments) > 0 {
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			d.fail(req, "I could not make sense of the arguments: %v", err)
+			return false
+		}
+	}
+
+	switch req.Command {
+	case "initialize":
+		d.respond(req, map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		})
+		d.event("initialized", map[string]any{})
+	case "launch":
+		if err := d.launch(args); err != nil {
+			d.fail(req, "%v", err)
+			return false
+		}
+		d.respond(req, nil)
+		d.startIfReady()
+	case "setBreakpoints":
+		d.respond(req, map[string]any{"breakpoints": d.setBreakpoints(args)})
+	case "configurationDone":
+		d.configured = true
+		d.respond(req, nil)
+		d.startIfReady()
+	case "threads":
+		d.respond(req, map[string]any{"threads": []any{map[string]any{"id": DAP_THREAD, "name": "main"}}})
+	case "pause":
+		d.mu.Lock()
+		d.pauseAsked = true
+		d.mu.Unlock()
+		d.respond(req, nil)
+	case "continue", "next", "stepIn", "stepOut":
+		modes := map[string]stepMode{"continue": STEP_RUN, "next": STEP_OVER, "stepIn": STEP_IN, "stepOut": STEP_OUT}
+		if !d.isPaused() {
+			d.fail(req, "the program is not paused")
+			return false
+		}
+		d.respond(req, map[string]any{"allThreadsContinued": true})
+		d.proceed(modes[req.Command])
+	case "stackTrace":
+		if !d.isPaused() {
+			d.fail(req, "the program is not paused")
+			return false
+		}
+		frames := d.stackTrace()
+		d.respond(req, map[string]any{"stackFrames": frames, "totalFrames": len(frames)})
+	case "scopes":
+		if !d.isPaused() || args.FrameId < 1 || args.FrameId > len(d.stack) {
+			d.fail(req, "there is no frame %d", args.FrameId)
+			return false
+		}
+		d.respond(req, map[string]any{"scopes": d.scopes(d.stack[args.FrameId-1])})
+	case "variables":
+		if !d.isPaused() || args.VariablesReference < 1 || args.VariablesReference > len(d.handles) {
+			d.fail(req, "there are no variables behind %d", args.VariablesReference)
+			return false
+		}
+		d.respond(req, map[string]any{"variables": d.variables(d.handles[args.VariablesReference-1])})
+	case "evaluate":
+		if !d.isPaused() {
+			d.fail(req, "the program is not paused")
+			return false
+		}
+		value, err := d.evaluate(args)
+		if err != nil {
+			d.fail(req, "%v", err)
+			return false
+		}
+		d.respond(req, map[string]any{
+			"result":             value.PrettyPrint(),
+			"type":               bsTypeName(value),
+			"variablesReference": d.reference(value),
+		})
+	case "terminate":
+		d.respond(req, nil)
+		d.terminate()
+	case "disconnect":
+		d.respond(req, nil)
+		d.terminate()
+		return true
+	default:
+		d.fail(req, "I do not know how to %s", req.Command)
+	}
+	return false
+}
+
+func (d *dapSession) launch(args dapArguments) error {
+	if args.Program == "" {
+		return fmt.Errorf("launch needs a program to run")
+	}
+	file, err := os.Open(args.Program)
+	if err != nil {
+		return fmt.Errorf("Error opening file '%s': %s", args.Program, err)
+	}
+	defer file.Close()
+	ast, err := parseSource(d.opts, FileSource{args.Program, bufio.NewReader(file)})
+	if err != nil {
+		return err
+	}
+	d.ast = ast
+	d.args = args.Args
+	d.launched = true
+	d.mu.Lock()
+	d.entry = args.StopOnEntry
+	d.mu.Unlock()
+	return nil
+}
+
+// editors send launch and configurationDone in whatever order they like
+func (d *dapSession) startIfReady() {
+	if !d.launched || !d.configured || d.started {
+		return
+	}
+	d.started = true
+	d.done = make(chan int, 1)
+
+	// stdin and stdout belong to the protocol, the program gets its output sent as events
+	opts := *d.opts
+	opts.istr = strings.NewReader("")
+	opts.ostr = dapOutput{d, "stdout"}
+	opts.estr = dapOutput{d, "stderr"}
+	env := MakeEnv(&opts)
+	LoadBuiltins(env)
+	LoadArguments(env, d.args)
+	env.program.hook = d
+	d.start(env)
+
+	go func() {
+		code := 0
+		val := EvalAll(env, d.ast)
+		if exit, ok := unwindCause(val).(BsExitExc); ok {
+			code = exit.code
+		} else if val.ShouldUnwind() {
+			fmt.Fprintf(opts.estr, "Failure occured during runtime:\n%v\n", val.PrettyPrint())
+			code = EXIT_RUNTIME_FAILURE
+		}
+		d.event("exited", map[string]any{"exitCode": code})
+		d.event("terminated", map[string]any{})
+		d.done <- code
+	}()
+}
+
+type dapOutput struct {
+	d        *dapSession
+	category string
+}
+
+func (o dapOutput) Write(p []byte) (int, error) {
+	o.d.event("output", map[string]any{"category": o.category, "output": string(p)})
+	return len(p), nil
+}
+
+// stops the program at its next statement, and waits for it
+func (d *dapSession) terminate() {
+	d.mu.Lock()
+	d.terminating = true
+	d.mu.Unlock()
+	if d.done == nil {
+		return
+	}
+	d.proceed(STEP_RUN)
+	<-d.done
+	d.done = nil
+}
+
+func (d *dapSession) isPaused() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused
+}
+
+// lets a paused program go on, until mode says it has to stop again
+func (d *dapSession) proceed(mode stepMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.paused {
+		return
+	}
+	d.paused = false
+	d.debugTracker.proceed(mode)
+	d.handles = nil
+	d.resume <- true
+}
+
+func (d *dapSession) setBreakpoints(args dapArguments) []map[string]any {
+	lines := make(map[int]bool)
+	verified := make([]map[string]any, len(args.Breakpoints))
+	statements := statementLines(d.ast, make(map[int]bool))
+	for i, bp := range args.Breakpoints {
+		lines[bp.Line] = true
+		// before launch we can not know yet, so we take their word for it
+		ok := !d.launched || d.absPath(args.Source.Path) != d.absPath(d.sourceName()) || statements[bp.Line]
+		verified[i] = map[string]any{"verified": ok, "line": bp.Line}
+	}
+	path := d.absPath(args.Source.Path)
+	d.mu.Lock()
+	d.breakpoints[path] = lines
+	d.mu.Unlock()
+	return verified
+}
+
+func (d *dapSession) sourceName() string {
+	for _, node := range d.ast {
+		if !isBlank(node) {
+			return node.Span().SourceName
+		}
+	}
+	return ""
+}
+
+func (d *dapSession) absPath(path string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if abs, ok := d.absPaths[path]; ok {
+		return abs
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	d.absPaths[path] = abs
+	return abs
+}
+
+// ==========================================
+// following along with the program
+
+func (d *dapSession) Statement(env *BsEnv, node Ast) BsValue {
+	if !d.at(env, node) {
+		return nil
+	}
+	path := d.absPath(node.Span().SourceName)
+
+	d.mu.Lock()
+	if d.terminating {
+		d.mu.Unlock()
+		return BsExitExc{code: 0}
+	}
+	reason := "pause"
+	if !d.pauseAsked {
+		reason = d.stopReason(node, path)
+	}
+	if reason == "" {
+		d.mu.Unlock()
+		return nil
+	}
+	d.paused = true
+	d.pauseAsked = false
+	d.mu.Unlock()
+
+	d.event("stopped", map[string]any{"reason": reason, "threadId": DAP_THREAD, "allThreadsStopped": true})
+	<-d.resume
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.terminating {
+		return BsExitExc{code: 0}
+	}
+	return nil
+}
+
+func (d *dapSession) Enter(env *BsEnv, fun BsRuntimeFunc) { d.enter(env, fun) }
+func (d *dapSession) Leave(env *BsEnv, fun BsRuntimeFunc) { d.leave() }
+
+// ==========================================
+// looking around while the program is paused
+
+func (d *dapSession) stackTrace() []map[string]any {
+	frames := make([]map[string]any, 0, len(d.stack))
+	for i := len(d.stack) - 1; i >= 0; i -= 1 {
+		frame := map[string]any{"id": i + 1, "name": d.stack[i].name, "line": 0, "column": 0}
+		if node := d.stack[i].node; node != nil {
+			spn := node.Span()
+			frame["line"] = spn.Lineno
+			frame["column"] = spn.Begin + 1
+			frame["source"] = map[string]any{"name": filepath.Base(spn.SourceName), "path": d.absPath(spn.SourceName)}
+		}
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// every scope a frame can see, innermost first
+func (d *dapSession) scopes(frame debugFrame) []map[string]any {
+	scopes := make([]map[string]any, 0, 2)
+	for scope := frame.env; scope != nil && !scope.library; scope = scope.parent {
+		name := "Enclosing"
+		if scope.parent == nil || scope.parent.library {
+			name = "Globals"
+		} else if scope == frame.env {
+			name = "Locals"
+		}
+		scopes = append(scopes, map[string]any{
+			"name":               name,
+			"variablesReference": d.reference(scope),
+			"expensive":          false,
+		})
+	}
+	return scopes
+}
+
+func (d *dapSession) variables(of any) []map[string]any {
+	variables := make([]map[string]any, 0)
+	variable := func(name string, value BsValue) {
+		variables = append(variables, map[string]any{
+			"name":               name,
+			"value":              value.PrettyPrint(),
+			"type":               bsTypeName(value),
+			"variablesReference": d.reference(value),
+		})
+	}
+	switch v := of.(type) {
+	case *BsEnv:
+		for _, name := range programNames(v) {
+			variable(name, v.symbols[name])
+		}
+	case BsListVal:
+		for i, item := range v.items {
+			variable(fmt.Sprintf("[%d]", i+1), item)
+		}
+	}
+	return variables
+}
+
+// a reference the editor can ask about, for things that have something inside of them
+func (d *dapSession) reference(of any) int {
+	switch v := of.(type) {
+	case BsListVal:
+		if len(v.items) == 0 {
+			return 0
+		}
+	case *BsEnv:
+	default:
+		return 0
+	}
+	d.handles = append(d.handles, of)
+	return len(d.handles)
+}
+
+// runs an expression in a paused frame, the innermost one unless it says otherwise
+func (d *dapSession) evaluate(args dapArguments) (BsValue, error) {
+	env := d.stack[len(d.stack)-1].env
+	if args.FrameId >= 1 && args.FrameId <= len(d.stack) {
+		env = d.stack[args.FrameId-1].env
+	}
+	return d.debugTracker.evaluate(d.opts, env, args.Expression)
+}
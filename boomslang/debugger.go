@@ -0,0 +1,373 @@
+package boomslang
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Debugging: following a running program through its EvalHook.
+// The tracker is shared by the debug adapter and the debugger in the terminal,
+// it knows the call stack and decides where the program has to stop
+
+type stepMode int
+
+const (
+	STEP_RUN stepMode = iota
+	STEP_IN
+	STEP_OVER
+	STEP_OUT
+)
+
+// one procedure invocation in progress, the program itself is the first
+type debugFrame struct {
+	name string
+	env  *BsEnv
+	node Ast // the statement it is at
+}
+
+type debugTracker struct {
+	stack       []debugFrame
+	breakpoints map[string]map[int]bool // lines, by source name
+	mode        stepMode
+	stepDepth   int
+	entry       bool // stop before the very first statement
+	evaluating  bool // the debugger is running code itself, nothing to follow
+}
+
+func (t *debugTracker) start(env *BsEnv) {
+	t.stack = []debugFrame{{name: "main", env: env}}
+	if t.breakpoints == nil {
+		t.breakpoints = make(map[string]map[int]bool)
+	}
+}
+
+// moves the innermost frame along to node, returns false for statements not worth stopping at
+func (t *debugTracker) at(env *BsEnv, node Ast) bool {
+	if t.evaluating || isBlank(node) {
+		return false
+	}
+	top := &t.stack[len(t.stack)-1]
+	top.env, top.node = env, node
+	return true
+}
+
+// why the program has to stop before node, empty if it does not
+func (t *debugTracker) stopReason(node Ast, source string) string {
+	depth := len(t.stack)
+	switch {
+	case t.entry:
+		t.entry = false
+		return "entry"
+	case t.mode == STEP_IN,
+		t.mode == STEP_OVER && depth <= t.stepDepth,
+		t.mode == STEP_OUT && depth < t.stepDepth:
+		return "step"
+	case t.breakpoints[source][node.Span().Lineno]:
+		return "breakpoint"
+	}
+	return ""
+}
+
+// steps are counted from the frame the program is in now
+func (t *debugTracker) proceed(mode stepMode) {
+	t.mode = mode
+	t.stepDepth = len(t.stack)
+}
+
+func (t *debugTracker) enter(env *BsEnv, fun BsRuntimeFunc) {
+	if t.evaluating {
+		return
+	}
+	frame := debugFrame{name: "<unnamed procedure>", env: env}
+	if fun.name != nil {
+		frame.name, frame.node = fun.name.name, *fun.name
+	}
+	t.stack = append(t.stack, frame)
+}
+
+func (t *debugTracker) leave() {
+	if t.evaluating {
+		return
+	}
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+// the debugger only looks ahead, what statements came to shows up in its variables
+func (t *debugTracker) Evaluated(env *BsEnv, node Ast, value BsValue) {}
+
+// the call stack, innermost first, in the frames runtime failures collect
+func (t *debugTracker) where() []BsEvalFrame {
+	frames := make([]BsEvalFrame, 0, len(t.stack))
+	for i := len(t.stack) - 1; i >= 0; i -= 1 {
+		frame := t.stack[i]
+		msg := "in " + frame.name
+		if frame.node != nil {
+			spn := frame.node.Span()
+			msg = fmt.Sprintf("in %s at %s:%d", frame.name, spn.SourceName, spn.Lineno)
+		}
+		frames = append(frames, BsEvalFrame{node: frame.node, msg: msg})
+	}
+	return frames
+}
+
+// runs an expression (or even a statement) where the program is paused
+func (t *debugTracker) evaluate(opts *Opts, env *BsEnv, expression string) (BsValue, error) {
+	expression = strings.TrimSpace(expression)
+
+	// a bare word is usually a name, editors hover over them like that
+	if !strings.Contains(expression, " ") {
+		if value := env.Lookup(expression); !value.ShouldUnwind() {
+			return value, nil
+		}
+	}
+
+	ast, err := parseSource(opts, MakeReaderSource("<evaluate>", strings.NewReader(expression)))
+	if err != nil {
+		return nil, err
+	}
+	t.evaluating = true
+	value := EvalAll(env, ast)
+	t.evaluating = false
+	if value.ShouldUnwind() {
+		return nil, fmt.Errorf("%s", strings.TrimRight(value.PrettyPrint(), "\n"))
+	}
+	return value, nil
+}
+
+func parseSource(opts *Opts, source Source) ([]Ast, error) {
+	tokens, err := MakeLexer(opts, MakePreprocessor(opts, source)).Lex()
+	if err != nil {
+		return nil, err
+	}
+	return MakeParser(opts, tokens).Parse()
+}
+
+// the lines a breakpoint can stop on
+func statementLines(ast []Ast, lines map[int]bool) map[int]bool {
+	for _, node := range ast {
+		if isBlank(node) {
+			continue
+		}
+		lines[node.Span().Lineno] = true
+		switch n := node.(type) {
+		case AstFuncDef:
+			statementLines(n.body, lines)
+		case AstIfStmnt:
+			statementLines(n.else_block, statementLines(n.if_block, lines))
+		case AstLoop:
+			statementLines(n.else_block, statementLines(n.block, lines))
+		}
+	}
+	return lines
+}
+
+// the names a scope holds for the program, without the builtins that live next to them
+func programNames(scope *BsEnv) []string {
+	names := make([]string, 0, len(scope.symbols))
+	for name, value := range scope.symbols {
+		if !isBuiltinValue(name, value) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isBuiltinValue(name string, value BsValue) bool {
+	if strings.HasPrefix(name, "_") {
+		return true
+	}
+	fun, ok := value.(BsFunVal)
+	if !ok {
+		return false
+	}
+	_, ok = fun.thunk.(BsRuntimeFunc)
+	return !ok
+}
+
+// ==========================================
+//
+//	boomslang debug file.bs [args...]
+//	  runs a program under a gdb like prompt, starting before its first statement
+
+const DEBUG_PROMPT string = "(debug) "
+
+type termDebugger struct {
+	debugTracker
+	opts       *Opts
+	in         *bufio.Reader // shared with the program, so ask does not lose anything
+	out        io.Writer
+	source     string
+	lines      []string
+	statements map[int]bool
+	last       string // an empty command repeats this one
+	quit       bool
+}
+
+func runDebug(opts *Opts, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintf(opts.estr, "Bad flag: debug needs a file to run\n")
+		return EXIT_BAD_OPTS
+	}
+	filePath := args[0]
+	text, err := os.ReadFile(filePath)
+	if err != nil {
+		fmt.Fprintf(opts.estr, "Error opening file '%s': %s\n", filePath, err)
+		return EXIT_BAD_FILE
+	}
+
+	t := new(termDebugger)
+	t.opts = opts
+	t.in = bufio.NewReader(opts.istr)
+	t.out = opts.ostr
+	t.source = filePath
+	t.lines = strings.Split(string(text), "\n")
+	t.statements = make(map[int]bool)
+	if ast, err := parseSource(opts, FileSource{filePath, bufio.NewReader(strings.NewReader(string(text)))}); err == nil {
+		statementLines(ast, t.statements)
+	}
+	t.entry = true
+
+	programOpts := *opts
+	programOpts.istr = t.in
+	programOpts.args = args[1:]
+	env := MakeEnv(&programOpts)
+	LoadBuiltins(env)
+	LoadArguments(env, programOpts.args)
+	env.program.hook = t
+	t.start(env)
+
+	rc, _ := run(&programOpts, FileSource{filePath, bufio.NewReader(strings.NewReader(string(text)))}, env)
+	if !t.quit {
+		fmt.Fprintf(t.out, "the program finished with status %d\n", rc)
+	}
+	return rc
+}
+
+func (t *termDebugger) Statement(env *BsEnv, node Ast) BsValue {
+	if !t.at(env, node) {
+		return nil
+	}
+	if t.quit {
+		return BsExitExc{code: 0}
+	}
+	reason := t.stopReason(node, node.Span().SourceName)
+	if reason == "" {
+		return nil
+	}
+	spn := node.Span()
+	fmt.Fprintf(t.out, "stopped at %s:%d (%s)\n", spn.SourceName, spn.Lineno, reason)
+	t.showLine(spn)
+	return t.prompt()
+}
+
+func (t *termDebugger) Enter(env *BsEnv, fun BsRuntimeFunc) { t.enter(env, fun) }
+func (t *termDebugger) Leave(env *BsEnv, fun BsRuntimeFunc) { t.leave() }
+
+func (t *termDebugger) showLine(spn Span) {
+	if spn.SourceName == t.source && spn.Lineno >= 1 && spn.Lineno <= len(t.lines) {
+		fmt.Fprintf(t.out, "%4d  %s\n", spn.Lineno, strings.TrimRight(t.lines[spn.Lineno-1], "\r"))
+	}
+}
+
+// takes commands until one of them lets the program go on
+func (t *termDebugger) prompt() BsValue {
+	for {
+		fmt.Fprint(t.out, DEBUG_PROMPT)
+		line, err := readLine(t.in)
+		if err != nil {
+			fmt.Fprint(t.out, "\n")
+			t.quit = true
+			return BsExitExc{code: 0}
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			line = t.last
+		}
+		t.last = line
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch command {
+		case "":
+		case "step", "s":
+			t.proceed(STEP_IN)
+			return nil
+		case "next", "n":
+			t.proceed(STEP_OVER)
+			return nil
+		case "finish":
+			t.proceed(STEP_OUT)
+			return nil
+		case "continue", "c":
+			t.proceed(STEP_RUN)
+			return nil
+		case "break", "b":
+			t.setBreakpoint(arg)
+		case "where", "bt":
+			fmt.Fprint(t.out, formatFrames(t.where()))
+		case "print", "p":
+			value, err := t.evaluate(t.opts, t.stack[len(t.stack)-1].env, arg)
+			if err != nil {
+				fmt.Fprintf(t.out, "%v\n", err)
+			} else {
+				fmt.Fprintf(t.out, "%s\n", value.PrettyPrint())
+			}
+		case "locals":
+			env := t.stack[len(t.stack)-1].env
+			for _, name := range programNames(env) {
+				fmt.Fprintf(t.out, "the %s is %s\n", name, env.symbols[name].PrettyPrint())
+			}
+		case "quit", "q":
+			t.quit = true
+			return BsExitExc{code: 0}
+		case "help", "h":
+			t.help()
+		default:
+			fmt.Fprintf(t.out, "I do not know '%s', try help\n", command)
+		}
+	}
+}
+
+func (t *termDebugger) setBreakpoint(arg string) {
+	if arg == "" {
+		lines := make([]int, 0, len(t.breakpoints[t.source]))
+		for line := range t.breakpoints[t.source] {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			fmt.Fprintf(t.out, "breakpoint at %s:%d\n", t.source, line)
+		}
+		return
+	}
+	line, err := strconv.Atoi(arg)
+	if err != nil || !t.statements[line] {
+		fmt.Fprintf(t.out, "there is no statement on line '%s' to stop at\n", arg)
+		return
+	}
+	if t.breakpoints[t.source] == nil {
+		t.breakpoints[t.source] = make(map[int]bool)
+	}
+	t.breakpoints[t.source][line] = true
+	fmt.Fprintf(t.out, "breakpoint at %s:%d\n", t.source, line)
+}
+
+func (t *termDebugger) help() {
+	fmt.Fprint(t.out, ""+
+		"break <line>   stop whenever that line is about to run, without a line lists them\n"+
+		"step           run until the next statement, going into procedures\n"+
+		"next           run until the next statement, going over procedures\n"+
+		"finish         run until the current procedure returns\n"+
+		"continue       run until a breakpoint\n"+
+		"where          show the procedures that are running\n"+
+		"print <expr>   show the value of an expression\n"+
+		"locals         show the names of the current procedure\n"+
+		"quit           stop the program\n"+
+		"an empty line repeats the last command\n")
+}
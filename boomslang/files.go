@@ -0,0 +1,230 @@
+package boomslang
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Builtins for the file system. Paths are taken as they are, relative ones from where the program was started.
+// Everything that goes wrong comes back as a BsIoErr
+
+func ioFailure(err error) BsValue {
+	return BsIoErr{msg: err.Error()}
+}
+
+// ==========================================
+//
+//	contents
+//	  reads a whole file
+//	  returns it as text
+func (r BuiltinRegistry) RegisterContents(env *BsEnv) {
+	env.provide(CAP_FILESYSTEM, "contents", MustWrapFunc("contents", func(env *BsEnv, path string) BsValue {
+		text, failure := readText(env, path)
+		if failure != nil {
+			return failure
+		}
+		return BsStrVal{value: text}
+	}))
+}
+
+// reads a whole file, but never more of it than fits in a text
+func readText(env *BsEnv, path string) (string, BsValue) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", ioFailure(err)
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if maxText := env.program.budget.limits.maxText; maxText > 0 {
+		// one byte more than allowed is enough to know it is too much
+		reader = io.LimitReader(file, int64(maxText)+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return "", ioFailure(err)
+	}
+	if failure := env.program.budget.canMakeText(len(data)); failure != nil {
+		return "", failure
+	}
+	return string(data), nil
+}
+
+// ==========================================
+//
+//	lines
+//	  reads a whole file
+//	  returns a list with a text for each line, without the line endings
+func (r BuiltinRegistry) RegisterLines(env *BsEnv) {
+	env.provide(CAP_FILESYSTEM, "lines", MustWrapFunc("lines", func(env *BsEnv, path string) BsValue {
+		data, failure := readText(env, path)
+		if failure != nil {
+			return failure
+		}
+		text := strings.TrimSuffix(data, "\n")
+		items := []BsValue{}
+		if len(data) > 0 {
+			if failure := env.program.budget.canMakeList(strings.Count(text, "\n") + 1); failure != nil {
+				return failure
+			}
+			for _, line := range strings.Split(text, "\n") {
+				items = append(items, BsStrVal{value: strings.TrimSuffix(line, "\r")})
+			}
+		}
+		return BsListVal{items: items}
+	}))
+}
+
+// ==========================================
+//
+//	write and append
+//	  put text into a file, making it when it is not there yet.
+//	  write throws away what was in the file before and writes the text as it is,
+//	  append keeps it and adds the text as a line at the end,
+//	  on a line of its own even when the file does not end in a newline.
+//	  A list of texts is written one line each
+func (r BuiltinRegistry) RegisterWrite(env *BsEnv) {
+	env.provide(CAP_FILESYSTEM, "write", MustWrapFunc("write", func(path string, text BsValue) BsValue {
+		return putText(path, text, os.O_TRUNC, "", "")
+	}))
+	env.provide(CAP_FILESYSTEM, "append", MustWrapFunc("append", func(path string, text BsValue) BsValue {
+		lead, failure := missingNewline(path)
+		if failure != nil {
+			return failure
+		}
+		return putText(path, text, os.O_APPEND, lead, "\n")
+	}))
+}
+
+// the newline a file still needs before anything is added to the end of it
+func missingNewline(path string) (string, BsValue) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", ioFailure(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", ioFailure(err)
+	}
+	if info.Size() == 0 {
+		return "", nil
+	}
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return "", ioFailure(err)
+	}
+	if last[0] == '\n' {
+		return "", nil
+	}
+	return "\n", nil
+}
+
+func putText(path string, text BsValue, mode int, lead string, ending string) BsValue {
+	content := lead
+	switch v := text.(type) {
+	case BsStrVal:
+		content += v.value + ending
+	case BsListVal:
+		var b strings.Builder
+		for _, item := range v.items {
+			line, ok := item.(BsStrVal)
+			if !ok {
+				return BsTypeErr{expected: "text", value: item}
+			}
+			b.WriteString(line.value + "\n")
+		}
+		content += b.String()
+	default:
+		return BsTypeErr{expected: "text or list of texts", value: text}
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|mode, 0644)
+	if err != nil {
+		return ioFailure(err)
+	}
+	_, err = file.WriteString(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return ioFailure(err)
+	}
+	return BsNilVal{}
+}
+
+// ==========================================
+//
+//	exists
+//	  returns whether there is a file or directory at a path
+func (r BuiltinRegistry) RegisterExists(env *BsEnv) {
+	env.provide(CAP_FILESYSTEM, "exists", MustWrapFunc("exists", func(path string) BsValue {
+		_, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return BsBooleVal{value: false}
+		}
+		if err != nil {
+			return ioFailure(err)
+		}
+		return BsBooleVal{value: true}
+	}))
+}
+
+// ==========================================
+//
+//	files
+//	  lists what is in a directory
+//	  returns the names, in alphabetical order
+func (r BuiltinRegistry) RegisterFiles(env *BsEnv) {
+	env.provide(CAP_FILESYSTEM, "files", MustWrapFunc("files", func(env *BsEnv, path string) BsValue {
+		entries, failure := readDir(env, path)
+		if failure != nil {
+			return failure
+		}
+		items := make([]BsValue, len(entries))
+		for i, entry := range entries {
+			items[i] = BsStrVal{value: entry.Name()}
+		}
+		return BsListVal{items: items}
+	}))
+}
+
+// lists a directory, but never more of it than fits in a list
+func readDir(env *BsEnv, path string) ([]fs.DirEntry, BsValue) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return nil, ioFailure(err)
+	}
+	defer dir.Close()
+	count := -1
+	if maxItems := env.program.budget.limits.maxItems; maxItems > 0 {
+		count = maxItems + 1
+	}
+	entries, err := dir.ReadDir(count)
+	if err != nil && err != io.EOF {
+		return nil, ioFailure(err)
+	}
+	if failure := env.program.budget.canMakeList(len(entries)); failure != nil {
+		return nil, failure
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// ==========================================
+//
+//	remove
+//	  deletes a file (or an empty directory)
+func (r BuiltinRegistry) RegisterRemove(env *BsEnv) {
+	env.provide(CAP_FILESYSTEM, "remove", MustWrapFunc("remove", func(path string) BsValue {
+		if err := os.Remove(path); err != nil {
+			return ioFailure(err)
+		}
+		return BsNilVal{}
+	}))
+}
@@ -0,0 +1,307 @@
+package boomslang
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Formatting: parse a program and write it back out from the ast.
+// Blocks are indented with one tab per level, words are separated by a single space,
+// there is never more than one blank line in a row, and comments stay where they were
+
+// Formats a whole program, reading it from text.
+// A leading #! line is kept exactly as it was
+func FormatProgram(opts *Opts, name string, text string) (string, error) {
+	source := FileSource{name, bufio.NewReader(strings.NewReader(text))}
+	lexer := MakeLexer(opts, source)
+	lexer.lenient = true
+	tokens, err := lexer.Lex()
+	if err != nil {
+		return "", err
+	}
+	parser := MakeParser(opts, tokens)
+	ast, err := parser.Parse()
+	if err != nil {
+		return "", err
+	}
+
+	f := formatter{
+		lines:    make([]string, 0, len(tokens)/4),
+		comments: make(map[int]Token),
+	}
+	for _, comment := range lexer.Comments() {
+		f.comments[comment.Spn.Lineno] = comment
+	}
+	f.flush(f.block(ast, 0), 0)
+
+	b := new(strings.Builder)
+	if strings.HasPrefix(text, "#!") {
+		shebang, _, _ := strings.Cut(text, "\n")
+		b.WriteString(strings.TrimRight(shebang, " \t\r") + "\n")
+	}
+	for _, line := range normalizeBlankLines(f.lines) {
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+type formatter struct {
+	lines    []string
+	comments map[int]Token // by line number
+}
+
+// emits a line, along with the comment that was at the end of it
+func (f *formatter) emit(depth int, line string, spn Span) {
+	if comment, ok := f.comments[spn.Lineno]; ok {
+		line += " " + comment.Lex
+	}
+	f.lines = append(f.lines, strings.Repeat("\t", depth)+line)
+}
+
+// Prints the statements of a block.
+// Blank lines and comments at the very end of it are handed back to the caller,
+// unless the comments were indented like the rest of the block
+func (f *formatter) block(ast []Ast, depth int) []Ast {
+	column := -1
+	var tail []Ast
+	for _, node := range ast {
+		if isBlank(node) {
+			tail = append(tail, node)
+			continue
+		}
+		if column < 0 {
+			column = node.Span().Begin
+		}
+		f.flush(tail, depth)
+		tail = f.stmnt(node, depth)
+	}
+
+	keep := 0
+	for i, node := range tail {
+		if comment, ok := f.comments[node.Span().Lineno]; ok && column >= 0 && comment.Spn.Begin >= column {
+			keep = i + 1
+		}
+	}
+	f.flush(tail[:keep], depth)
+	return tail[keep:]
+}
+
+// prints blank lines and lines that only have a comment
+func (f *formatter) flush(blanks []Ast, depth int) {
+	for _, node := range blanks {
+		if comment, ok := f.comments[node.Span().Lineno]; ok {
+			f.lines = append(f.lines, strings.Repeat("\t", depth)+comment.Lex)
+		} else {
+			f.lines = append(f.lines, "")
+		}
+	}
+}
+
+// prints one statement, handing back whatever trails the blocks inside of it
+func (f *formatter) stmnt(node Ast, depth int) []Ast {
+	switch n := node.(type) {
+	case AstIfStmnt:
+		f.emit(depth, "if "+formatExpr(n.cond), n.spn)
+		return f.elseBlock(f.block(n.if_block, depth+1), n, depth)
+	case AstLoop:
+		f.emit(depth, "while "+formatExpr(n.cond), n.spn)
+		tail := f.block(n.block, depth+1)
+		if len(n.else_block) == 0 {
+			return tail
+		}
+		f.flush(tail, depth+1)
+		f.emit(depth, "otherwise", n.otherwise)
+		return f.block(n.else_block, depth+1)
+	case AstFuncDef:
+		f.emit(depth, formatFunDef(n), n.spn)
+		return f.block(n.body, depth+1)
+	case AstAssign:
+		f.emit(depth, formatExpr(n.lvalue)+" is "+formatExpr(n.rvalue), n.spn)
+	case AstBreak:
+		f.emit(depth, "break", n.spn)
+	case AstBorrow:
+		f.emit(depth, "borrow "+formatExpr(n.name)+" from "+formatExpr(n.path), n.spn)
+	case AstReturns:
+		if isBlank(n.expr) {
+			f.emit(depth, "returns", n.spn)
+		} else {
+			f.emit(depth, "returns "+formatExpr(n.expr), n.spn)
+		}
+	default:
+		f.emit(depth, formatExpr(node), node.Span())
+	}
+	return nil
+}
+
+// an else block holding nothing but another if statement is spelled with otif
+func (f *formatter) elseBlock(tail []Ast, n AstIfStmnt, depth int) []Ast {
+	if len(n.else_block) == 0 {
+		return tail
+	}
+	f.flush(tail, depth+1)
+	if len(n.else_block) == 1 {
+		if otif, ok := n.else_block[0].(AstIfStmnt); ok && f.comments[n.otherwise.Lineno].Lex == "" {
+			f.emit(depth, "otif "+formatExpr(otif.cond), otif.spn)
+			return f.elseBlock(f.block(otif.if_block, depth+1), otif, depth)
+		}
+	}
+	f.emit(depth, "otherwise", n.otherwise)
+	return f.block(n.else_block, depth+1)
+}
+
+func formatExpr(node Ast) string {
+	switch n := node.(type) {
+	case AstIdent:
+		return "the " + n.name
+	case AstLiteral:
+		if s, ok := n.value.(BsStrVal); ok {
+			return strings.TrimSpace("text " + s.value)
+		}
+		return n.value.PrettyPrint()
+	case AstFunCall:
+		if !n.of && len(n.args) == 2 {
+			if ident, ok := n.fun.(AstIdent); ok {
+				for _, infix := range infixBuiltins {
+					if infix.symbol == ident.name {
+						return formatExpr(n.args[0]) + " " + infix.opname + " " + formatExpr(n.args[1])
+					}
+				}
+			}
+		}
+		args := make([]string, len(n.args))
+		for i, arg := range n.args {
+			args[i] = formatExpr(arg)
+		}
+		if n.quantity {
+			return args[0] + " " + formatFunHead(n.fun)
+		}
+		if n.of {
+			return strings.TrimSpace(formatFunHead(n.fun) + " of " + strings.Join(args, " and "))
+		}
+		return strings.TrimSpace(formatFunHead(n.fun) + " " + strings.Join(args, " and "))
+	}
+	return node.ShortName()
+}
+
+// the line that starts a procedure definition
+func formatFunDef(n AstFuncDef) string {
+	if len(n.params) == 0 {
+		return "by " + n.name.name + " we mean"
+	}
+	params := make([]string, len(n.params))
+	for i, param := range n.params {
+		params[i] = param.name
+	}
+	return strings.Join(strings.Fields("by "+n.name.name+" of "+strings.Join(params, " and ")+" we mean"), " ")
+}
+
+// single word procedures (and phrases like 'ask for a number') are called by their bare name
+func formatFunHead(node Ast) string {
+	if ident, ok := node.(AstIdent); ok && (!strings.Contains(ident.name, " ") || isPhrase(ident.name)) {
+		return ident.name
+	}
+	return formatExpr(node)
+}
+
+// blank lines parse into an empty statement
+func isBlank(node Ast) bool {
+	lit, ok := node.(AstLiteral)
+	if !ok {
+		return false
+	}
+	_, ok = lit.value.(BsNilVal)
+	return ok
+}
+
+// no blank lines at the very start or end, none opening a block,
+// none in front of otherwise/otif, and never two in a row
+func normalizeBlankLines(lines []string) []string {
+	out := make([]string, 0, len(lines))
+	pendingBlank := false
+	for _, line := range lines {
+		if line == "" {
+			pendingBlank = len(out) > 0
+			continue
+		}
+		trimmed := strings.TrimLeft(line, "\t")
+		continuesBlock := strings.HasPrefix(trimmed, "otherwise") || strings.HasPrefix(trimmed, "otif ")
+		if pendingBlank && !continuesBlock && !opensIndentedBlock(out[len(out)-1], line) {
+			out = append(out, "")
+		}
+		pendingBlank = false
+		out = append(out, line)
+	}
+	return out
+}
+
+func opensIndentedBlock(prev string, next string) bool {
+	indent := func(s string) int { return len(s) - len(strings.TrimLeft(s, "\t")) }
+	return indent(next) > indent(prev)
+}
+
+// ==========================================
+//
+//	boomslang fmt [--check] [files...]
+//	  rewrites the files in place, or reports the ones that would change.
+//	  with no files (or -) it formats stdin onto stdout
+func runFmt(opts *Opts, args []string) int {
+	check := false
+	files := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "--check" {
+			check = true
+		} else if strings.HasPrefix(arg, "--") {
+			fmt.Fprintf(opts.estr, "Bad flag: I do not recognize %s\n", arg)
+			return EXIT_BAD_OPTS
+		} else {
+			files = append(files, arg)
+		}
+	}
+	if len(files) == 0 {
+		files = append(files, "-")
+	}
+
+	rc := 0
+	for _, filePath := range files {
+		var text []byte
+		var err error
+		if filePath == "-" {
+			text, err = io.ReadAll(opts.istr)
+		} else {
+			text, err = os.ReadFile(filePath)
+		}
+		if err != nil {
+			fmt.Fprintf(opts.estr, "Error opening file '%s': %s\n", filePath, err)
+			rc = EXIT_BAD_FILE
+			continue
+		}
+
+		formatted, err := FormatProgram(opts, filePath, string(text))
+		if err != nil {
+			fmt.Fprintf(opts.estr, "\033[0;31m I am sorry, but I could not format '%s': %v\n\033[0m ", filePath, err)
+			rc = EXIT_PARSE_FAILURE
+			continue
+		}
+
+		if check {
+			if formatted != string(text) {
+				fmt.Fprintf(opts.ostr, "%s\n", filePath)
+				if rc == 0 {
+					rc = EXIT_NOT_FORMATTED
+				}
+			}
+		} else if filePath == "-" {
+			fmt.Fprint(opts.ostr, formatted)
+		} else if formatted != string(text) {
+			if err := os.WriteFile(filePath, []byte(formatted), 0644); err != nil {
+				fmt.Fprintf(opts.estr, "Error writing file '%s': %s\n", filePath, err)
+				rc = EXIT_BAD_FILE
+			}
+		}
+	}
+	return rc
+}
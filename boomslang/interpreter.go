@@ -0,0 +1,213 @@
+// Package boomslang runs boomslang programs, from the command line (see Main)
+// or from inside a Go program through an Interpreter:
+//
+//	interp := boomslang.NewInterpreter(boomslang.Options{Stdout: os.Stdout})
+//	interp.SetGlobal("order total", 120)
+//	result, err := interp.Eval(ctx, "returns the order total biggerthan 100")
+package boomslang
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// How an Interpreter talks to the world around it
+type Options struct {
+	Stdin  io.Reader // what ask reads from, nothing to read when nil
+	Stdout io.Writer // what show writes to, thrown away when nil
+	Stderr io.Writer // thrown away when nil
+	Args   []string  // the arguments programs see
+
+	// programs that get this far are stopped with a (TimeoutError), 0 for no limit
+	MaxSteps int64         // statements, loop iterations and procedure calls, per Eval
+	Timeout  time.Duration // per Eval
+
+	// procedures calling each other deeper than this fail with a (RecursionError),
+	// 0 for DEFAULT_MAX_DEPTH
+	MaxDepth int
+
+	// programs that want more than this fail with a (ResourceError), 0 for no limit
+	MaxTextLength int // bytes in one text
+	MaxListLength int // items in one list
+	MaxNames      int // names with a value at the same time
+
+	// fills the limits above that are 0 with safe ones,
+	// and leaves out the builtins that need more than SANDBOX_CAPABILITIES
+	Sandbox bool
+
+	// the builtins programs get, by what they reach for. nil for all of them
+	// (or just SANDBOX_CAPABILITIES with Sandbox), a 0 for none at all
+	Allow *Capability
+
+	// where random, pick and shuffle start from, so they make the same choices every time.
+	// nil for somewhere different for each Interpreter
+	Seed *int64
+
+	// what now and wait go by, nil for the system clock
+	Clock Clock
+}
+
+// One global scope that programs run in, one after the other.
+// An Interpreter is not safe to use from several goroutines at once
+type Interpreter struct {
+	opts    *Opts
+	env     *BsEnv
+	options Options
+}
+
+func NewInterpreter(options Options) *Interpreter {
+	opts := new(Opts)
+	opts.istr, opts.ostr, opts.estr = options.Stdin, options.Stdout, options.Stderr
+	if opts.istr == nil {
+		opts.istr = strings.NewReader("")
+	}
+	if opts.ostr == nil {
+		opts.ostr = io.Discard
+	}
+	if opts.estr == nil {
+		opts.estr = io.Discard
+	}
+	opts.args = options.Args
+	opts.sandbox = options.Sandbox
+	if options.Allow != nil {
+		opts.allow, opts.hasAllow = *options.Allow, true
+	}
+	if options.Seed != nil {
+		opts.seed, opts.hasSeed = *options.Seed, true
+	}
+	opts.clock = options.Clock
+
+	interp := &Interpreter{opts: opts, env: MakeEnv(opts), options: options}
+	LoadBuiltins(interp.env)
+	LoadArguments(interp.env, opts.args)
+	return interp
+}
+
+// A program that failed while it ran, Failure is what it failed with
+type RuntimeError struct {
+	Failure BsValue
+}
+
+func (e RuntimeError) Error() string {
+	return strings.TrimRight(e.Failure.PrettyPrint(), "\n")
+}
+
+// programs stopped through their context unwrap to the context's error
+func (e RuntimeError) Unwrap() error {
+	if timeout, ok := unwindCause(e.Failure).(BsTimeoutErr); ok {
+		return timeout.cause
+	}
+	return nil
+}
+
+// A program that stopped itself with exit
+type ExitError struct {
+	Code int
+}
+
+func (e ExitError) Error() string {
+	return fmt.Sprintf("the program exited with status %d", e.Code)
+}
+
+// Runs source in the global scope, whatever it assigns is still there for the next Eval.
+// The result is the value of the last statement (or what a returns at the top gave back),
+// converted like FromValue does. Programs that do not lex or parse give a LexError or ParseError.
+// The program is stopped when ctx is done or it goes past the limits in the Options
+func (interp *Interpreter) Eval(ctx context.Context, source string) (any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ast, err := parseSource(interp.opts, MakeReaderSource("<eval>", strings.NewReader(source)))
+	if err != nil {
+		return nil, err
+	}
+	limits := evalLimits{
+		maxSteps: interp.options.MaxSteps,
+		timeout:  interp.options.Timeout,
+		maxDepth: interp.options.MaxDepth,
+		maxText:  interp.options.MaxTextLength,
+		maxItems: interp.options.MaxListLength,
+		maxNames: interp.options.MaxNames,
+	}
+	if interp.options.Sandbox {
+		limits = limits.orDefaults(SANDBOX_LIMITS)
+	}
+	done := interp.env.limit(ctx, limits)
+	out := EvalAll(interp.env, ast)
+	done()
+	switch v := unwindCause(out).(type) {
+	case BsReturnsExc:
+		return FromValue(v.value), nil
+	case BsExitExc:
+		return nil, ExitError{Code: v.code}
+	}
+	if out.ShouldUnwind() {
+		return nil, RuntimeError{Failure: out}
+	}
+	return FromValue(out), nil
+}
+
+// Gives a global name a value, converted like ToValue does
+func (interp *Interpreter) SetGlobal(name string, value any) error {
+	converted, err := ToValue(value)
+	if err != nil {
+		return err
+	}
+	interp.env.AssignName(name, converted)
+	return nil
+}
+
+// The value of a global name, converted like FromValue does
+func (interp *Interpreter) Global(name string) (any, bool) {
+	value := interp.env.Lookup(name)
+	if value.ShouldUnwind() {
+		return nil, false
+	}
+	return FromValue(value), true
+}
+
+// A procedure written in Go. It gets its arguments converted like FromValue does,
+// its result is converted like ToValue does and an error makes the program fail
+type Builtin func(args []any) (any, error)
+
+// Makes fn a builtin procedure programs can call by name, next to show and ask
+func (interp *Interpreter) RegisterBuiltin(name string, fn Builtin) {
+	interp.env.parent.AssignName(name, BsFunVal{thunk: BsGoFunc{name: name, fn: fn}})
+}
+
+// Makes any Go function a builtin procedure, see WrapFunc for the functions that work
+func (interp *Interpreter) RegisterFunc(name string, fn any) error {
+	fun, err := WrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	interp.env.parent.AssignName(name, fun)
+	return nil
+}
+
+type BsGoFunc struct {
+	name string
+	fn   Builtin
+}
+
+func (this BsGoFunc) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure '%s'>", this.name)
+}
+func (this BsGoFunc) Call(env *BsEnv, args []BsValue) BsValue {
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		converted[i] = FromValue(arg)
+	}
+	result, err := this.fn(converted)
+	if err != nil {
+		return BsHostErr{name: this.name, msg: err.Error()}
+	}
+	value, err := ToValue(result)
+	if err != nil {
+		return BsHostErr{name: this.name, msg: err.Error()}
+	}
+	return value
+}
@@ -1,4 +1,4 @@
-package main
+package boomslang
 
 import (
 	"errors"
@@ -34,6 +34,8 @@ const (
 	TOKEN_KW_BY                  = "TOKEN_KW_BY"
 	TOKEN_KW_WE_MEAN             = "TOKEN_KW_WE_MEAN"
 	TOKEN_KW_RETURNS             = "TOKEN_KW_RETURNS"
+	TOKEN_KW_BORROW              = "TOKEN_KW_BORROW"
+	TOKEN_COMMENT                = "TOKEN_COMMENT"
 )
 
 type Source interface {
@@ -57,22 +59,31 @@ type Token struct {
 type Lexer struct {
 	debug      bool
 	source     Source
+	name       string // where the line being lexed came from, usually the name of the source
 	lineno     int
 	indent     int
 	shiftWidth indentlevel
+	lenient    bool // let tabs and spaces be mixed, used when formatting
+	spaceWidth int  // how many spaces make one level when lenient
+	begin      int  // columns of the word being lexed, like lineno is its line
+	end        int
+	comments   []Token // kept to the side, the parser never sees them
 }
 
 func MakeLexer(opts *Opts, source Source) *Lexer {
 	lexer := new(Lexer)
 	lexer.source = source	
+	lexer.name = source.Name()
 	lexer.debug = opts.debug&DBG_LEX > 0
 	return lexer
 }
 
 func (l *Lexer) makeToken(lex string, ty TokenType) Token {
 	span := Span{
-		SourceName: l.source.Name(),
+		SourceName: l.name,
 		Lineno:     l.lineno,
+		Begin:      l.begin,
+		End:        l.end,
 	}
 	tok := Token{ty, lex, span}
 	return tok
@@ -83,7 +94,7 @@ func (l *Lexer) Lex() ([]Token, error) {
 	for {
 		newTokens, err := l.LexLine()
 		if err != nil {
-			return nil, err
+			return nil, l.lexErr(err)
 		}
 		for _, t := range newTokens {
 			tokens = append(tokens, t)
@@ -95,7 +106,7 @@ func (l *Lexer) Lex() ([]Token, error) {
 	// emit dedents down to zero
 	indentTokens, err := l.handleIndent(indentlevel{})
 	if err != nil {
-		return nil, err
+		return nil, l.lexErr(err)
 	}
 	for _, tok := range indentTokens {
 		tokens = append(tokens, tok)
@@ -107,11 +118,23 @@ func (l *Lexer) Lex() ([]Token, error) {
 
 	return tokens, nil
 }
+
+// whether the lines come from a file, also when they pass through the preprocessor first
+func (l *Lexer) fromFile() bool {
+	source := l.source
+	if pp, ok := source.(*Preprocessor); ok {
+		source = pp.Root()
+	}
+	_, ok := source.(FileSource)
+	return ok
+}
+
 func (l *Lexer) LexLine() ([]Token, error) {
 	if l.debug {
 		log.Printf("entering lexLine\n")
 	}
 	l.lineno += 1
+	l.begin, l.end = 0, 0
 	tokens := make([]Token, 0, 7)
 	line, err := l.source.ReadLine()
 	if err == io.EOF {
@@ -120,13 +143,35 @@ func (l *Lexer) LexLine() ([]Token, error) {
 	} else if err != nil {
 		return tokens,err
 	}
+	if mapped, ok := l.source.(MappedSource); ok {
+		l.name, l.lineno = mapped.Origin()
+	}
 
 	if l.debug {
 		log.Printf(" line no [%d] = %#v\n", l.lineno, line)
 	}
 
+	// a leading #! line is for the operating system, not for us.
+	// it still counts as a line so spans keep pointing at the right place
+	if l.fromFile() && l.lineno == 1 && strings.HasPrefix(line, "#!") {
+		tokens = append(tokens, l.makeToken("\n", TOKEN_NEWLINE))
+		return tokens, nil
+	}
+
+	// blank lines (and lines with only a comment) do not get a say in the indentation,
+	// otherwise a blank line without trailing whitespace would close every block
+	raw := strings.TrimRight(line, "\r\n")
+	if trimmed := strings.TrimSpace(raw); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		if trimmed != "" {
+			l.comment(raw, len(raw)-len(strings.TrimLeft(raw, " \t")))
+		}
+		l.begin, l.end = len(raw), len(raw)
+		tokens = append(tokens, l.makeToken("\n", TOKEN_NEWLINE))
+		return tokens, nil
+	}
+
 	// emit indents
-	line, indent := TrimIndent(line)
+	_, indent := TrimIndent(raw)
 	indentTokens, err := l.handleIndent(indent)
 	if err != nil {
 		return tokens, err
@@ -136,18 +181,21 @@ func (l *Lexer) LexLine() ([]Token, error) {
 	}
 
 	// word to token
-	line = strings.TrimSpace(line)
-	words := strings.Fields(line)
+	words, offsets := FieldsWithOffsets(raw)
 	// not using range so we can consume multi word tokens
 	for i := 0; i < len(words); i += 1 {
 		word := words[i]
+		l.begin, l.end = offsets[i], offsets[i]+len(word)
 		// dumb way of look ahead
 		var nextword string
 		if i+1 < len(words) {
 			nextword = words[i+1]
 		}
 
-		if word == "is" {
+		if strings.HasPrefix(word, "#") {
+			l.comment(raw, offsets[i])
+			break // the rest of the line is the comment
+		} else if word == "is" {
 			tokens = append(tokens, l.makeToken(word, TOKEN_KW_IS))
 		} else if word == "if" {
 			tokens = append(tokens, l.makeToken(word, TOKEN_KW_IF))
@@ -175,11 +223,15 @@ func (l *Lexer) LexLine() ([]Token, error) {
 			tokens = append(tokens, l.makeToken(word, TOKEN_KW_BY))
 		} else if word == "we" && nextword == "mean" {
 			i += 1
+			l.end = offsets[i] + len(nextword)
 			tokens = append(tokens, l.makeToken(word, TOKEN_KW_WE_MEAN))
 		} else if word == "returns" {
 			tokens = append(tokens, l.makeToken(word, TOKEN_KW_RETURNS))
+		} else if word == "borrow" {
+			tokens = append(tokens, l.makeToken(word, TOKEN_KW_BORROW))
 		} else if word == "text" {
 			text := strings.Join(words[i+1:], " ")
+			l.end = len(strings.TrimRight(raw, " \t"))
 			tokens = append(tokens, l.makeToken(text, TOKEN_TEXT))
 			break // break out of for loop
 		} else if unicode.IsNumber(FirstRune(word)) {
@@ -191,17 +243,53 @@ func (l *Lexer) LexLine() ([]Token, error) {
 	}
 
 	// emit newline
+	l.begin, l.end = len(raw), len(raw)
 	tokens = append(tokens, l.makeToken("\n", TOKEN_NEWLINE))
 
 	return tokens, nil
 }
 
+// remembers the comment starting at column begin of this line
+func (l *Lexer) comment(raw string, begin int) {
+	l.begin, l.end = begin, len(strings.TrimRight(raw, " \t"))
+	l.comments = append(l.comments, l.makeToken(raw[l.begin:l.end], TOKEN_COMMENT))
+}
+
+// errors remember the line they happened on, like parse errors do
+func (l *Lexer) lexErr(err error) error {
+	var lexErr LexError
+	if errors.As(err, &lexErr) {
+		return lexErr
+	}
+	return LexError{
+		msg: err.Error(),
+		spn: Span{SourceName: l.name, Lineno: l.lineno},
+	}
+}
+
+type LexError struct {
+	msg string
+	spn Span
+}
+
+func (e LexError) Error() string {
+	return fmt.Sprintf("lex error at %s:%d\n%s", e.spn.SourceName, e.spn.Lineno, e.msg)
+}
+
+// every comment seen so far, in order
+func (l *Lexer) Comments() []Token {
+	return l.comments
+}
+
 func (l *Lexer) handleIndent(newIndent indentlevel) ([]Token, error) {
 
 	if l.debug {
 		log.Printf("entering handleIndent, newIdent = %#v, curr = %#v, shiftWidth = %#v\n", newIndent, l.indent, l.shiftWidth)
 	}
 	curr := l.indent
+	if l.lenient {
+		return l.handleIndentLeniently(newIndent)
+	}
 	if l.shiftWidth.spaces == 0 && l.shiftWidth.tabs == 0 {
 		// if its zero, set the shift width for the first time
 		l.shiftWidth = newIndent
@@ -243,6 +331,33 @@ func (l *Lexer) handleIndent(newIndent indentlevel) ([]Token, error) {
 	return tokens, nil
 }
 
+// every tab is a level, and so is the first run of spaces we see (and any multiple of it)
+func (l *Lexer) handleIndentLeniently(newIndent indentlevel) ([]Token, error) {
+	if l.spaceWidth == 0 && newIndent.tabs == 0 {
+		l.spaceWidth = newIndent.spaces
+	}
+	newLevel := newIndent.tabs
+	if newIndent.spaces > 0 {
+		if l.spaceWidth == 0 || newIndent.spaces%l.spaceWidth != 0 {
+			return nil, errors.New(fmt.Sprintf("wrong number of spaces in indentation: %d. You are using %d", newIndent.spaces, l.spaceWidth))
+		}
+		newLevel += newIndent.spaces / l.spaceWidth
+	}
+
+	tokens := make([]Token, 0, 0)
+	if newLevel-l.indent > 1 {
+		return nil, errors.New(fmt.Sprintf("can not indent multiple at a time: you tried to indent %d levels", newLevel-l.indent))
+	}
+	if newLevel > l.indent {
+		tokens = append(tokens, l.makeToken("  ", TOKEN_BEGIN_INDENT))
+	}
+	for i := newLevel; i < l.indent; i += 1 {
+		tokens = append(tokens, l.makeToken("  ", TOKEN_END_INDENT))
+	}
+	l.indent = newLevel
+	return tokens, nil
+}
+
 func translateIndent(newIndent indentlevel, shiftWidth indentlevel) (int, error) {
 	if shiftWidth.tabs != 0 && shiftWidth.spaces != 0 {
 		return 0, errors.New("can not mix tabs and spaces")
@@ -0,0 +1,189 @@
+package boomslang
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Limits: a program can be stopped from the outside through a context,
+// or stopped once it has taken too many steps, too much time or too many nested calls.
+// Every statement, loop iteration and procedure call is a step.
+// Memory is kept in check where values are made: builtins that read or build text and lists
+// check how big they are going to be before making them, whatever else a procedure gives back
+// is checked when it does, and so are the names programs give values to
+
+// how deep procedures can call each other when nobody picked a limit,
+// far enough from where Go runs out of stack
+const DEFAULT_MAX_DEPTH int = 10000
+
+// how many of the innermost calls a BsRecursionErr shows
+const RECURSION_FRAMES int = 5
+
+type evalLimits struct {
+	maxSteps int64         // 0 for as many as it likes
+	timeout  time.Duration // 0 for as long as it likes
+	maxDepth int           // 0 for DEFAULT_MAX_DEPTH
+	maxText  int           // bytes in one text, 0 for no limit
+	maxItems int           // items in one list, 0 for no limit
+	maxNames int           // names with a value at the same time, 0 for no limit
+}
+
+// what --sandbox picks for the limits nobody picked themselves
+var SANDBOX_LIMITS = evalLimits{
+	maxSteps: 10_000_000,
+	timeout:  10 * time.Second,
+	maxDepth: 1000,
+	maxText:  1 << 20,
+	maxItems: 100_000,
+	maxNames: 10_000,
+}
+
+// fills the limits that are not set with the ones from defaults
+func (l evalLimits) orDefaults(defaults evalLimits) evalLimits {
+	if l.maxSteps == 0 {
+		l.maxSteps = defaults.maxSteps
+	}
+	if l.timeout == 0 {
+		l.timeout = defaults.timeout
+	}
+	if l.maxDepth == 0 {
+		l.maxDepth = defaults.maxDepth
+	}
+	if l.maxText == 0 {
+		l.maxText = defaults.maxText
+	}
+	if l.maxItems == 0 {
+		l.maxItems = defaults.maxItems
+	}
+	if l.maxNames == 0 {
+		l.maxNames = defaults.maxNames
+	}
+	return l
+}
+
+type evalBudget struct {
+	ctx    context.Context // nil for a program nobody is going to stop
+	limits evalLimits
+	steps  int64
+	calls  []*AstIdent // the procedures running right now, the innermost is last
+	names  int         // names with a value, in every scope that is still around
+}
+
+// the limits programs started with opts run under
+func (opts *Opts) evalLimits() evalLimits {
+	if opts.sandbox {
+		return opts.limits.orDefaults(SANDBOX_LIMITS)
+	}
+	return opts.limits
+}
+
+// set up for the next program, the returned function has to be called once it is done
+func (env *BsEnv) limit(ctx context.Context, limits evalLimits) func() {
+	cancel := func() {}
+	if limits.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, limits.timeout)
+	}
+	// names from earlier programs in the same scope are still around
+	env.program.budget = evalBudget{ctx: ctx, limits: limits, names: env.program.budget.names}
+	return cancel
+}
+
+// counts one step, giving back a failure when the program has to stop
+func (b *evalBudget) step() BsValue {
+	b.steps += 1
+	if b.limits.maxSteps > 0 && b.steps > b.limits.maxSteps {
+		return BsTimeoutErr{msg: fmt.Sprintf("it took more than the %d steps it was allowed", b.limits.maxSteps)}
+	}
+	if b.ctx == nil {
+		return nil
+	}
+	select {
+	case <-b.ctx.Done():
+		return stopped(b.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+// the failure for a program whose context is done
+func stopped(err error) BsValue {
+	if err == context.DeadlineExceeded {
+		return BsTimeoutErr{msg: "it ran out of time", cause: err}
+	}
+	return BsTimeoutErr{msg: "it was cancelled", cause: err}
+}
+
+// a procedure starts running, it has to leave again unless this fails
+func (b *evalBudget) enter(name *AstIdent) BsValue {
+	maxDepth := b.limits.maxDepth
+	if maxDepth <= 0 {
+		maxDepth = DEFAULT_MAX_DEPTH
+	}
+	if len(b.calls) >= maxDepth {
+		frames := make([]string, 0, RECURSION_FRAMES)
+		for i := len(b.calls) - 1; i >= 0 && len(frames) < RECURSION_FRAMES; i -= 1 {
+			frames = append(frames, describeCall(b.calls[i]))
+		}
+		return BsRecursionErr{depth: maxDepth, frames: frames}
+	}
+	b.calls = append(b.calls, name)
+	return nil
+}
+
+func (b *evalBudget) leave() {
+	b.calls = b.calls[:len(b.calls)-1]
+}
+
+func describeCall(name *AstIdent) string {
+	if name == nil {
+		return "<unnamed procedure>"
+	}
+	return fmt.Sprintf("%s, defined at %s:%d", name.name, name.spn.SourceName, name.spn.Lineno)
+}
+
+// checks a value that was just made, giving back a failure when it is too big
+func (b *evalBudget) made(value BsValue) BsValue {
+	switch v := value.(type) {
+	case BsStrVal:
+		return b.canMakeText(len(v.value))
+	case BsListVal:
+		return b.canMakeList(len(v.items))
+	}
+	return nil
+}
+
+// checks a text of size bytes may be made, before anybody makes it
+func (b *evalBudget) canMakeText(size int) BsValue {
+	if b.limits.maxText > 0 && size > b.limits.maxText {
+		return BsResourceErr{msg: fmt.Sprintf("a text of %d letters, when %d is the most it can have", size, b.limits.maxText)}
+	}
+	return nil
+}
+
+// checks a list of count items may be made, before anybody makes it
+func (b *evalBudget) canMakeList(count int) BsValue {
+	if b.limits.maxItems > 0 && count > b.limits.maxItems {
+		return BsResourceErr{msg: fmt.Sprintf("a list of %d items, when %d is the most it can have", count, b.limits.maxItems)}
+	}
+	return nil
+}
+
+// gives name a value in env, unless that would be one name too many.
+// The standard library does not count against the program
+func (env *BsEnv) bind(name string, value BsValue) BsValue {
+	if _, ok := env.symbols[name]; !ok && !env.library {
+		b := &env.program.budget
+		if b.limits.maxNames > 0 && b.names >= b.limits.maxNames {
+			return BsResourceErr{msg: fmt.Sprintf("more than the %d names it can give values to", b.limits.maxNames)}
+		}
+		b.names += 1
+	}
+	env.AssignName(name, value)
+	return nil
+}
+
+// a scope that is gone, its names do not count anymore
+func (b *evalBudget) release(scope *BsEnv) {
+	b.names -= len(scope.symbols)
+}
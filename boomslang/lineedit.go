@@ -0,0 +1,267 @@
+package boomslang
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const HISTORY_LIMIT int = 1000
+
+// A tiny line editor for the repl: arrow keys, history and tab completion.
+// Only used when the repl is attached to a terminal we can put into raw mode
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	fd       int // terminal to put into raw mode while reading, -1 for none
+	history  []string
+	histPath string // where the history is kept between sessions, empty for nowhere
+	complete func(prefix string) []string
+
+	// state of the line being edited
+	prompt  string
+	line    []rune
+	cursor  int
+	histPos int
+}
+
+func makeLineEditor(in *bufio.Reader, out io.Writer, fd int, histPath string) *lineEditor {
+	e := new(lineEditor)
+	e.in = in
+	e.out = out
+	e.fd = fd
+	e.histPath = histPath
+	e.complete = func(string) []string { return nil }
+	e.loadHistory()
+	return e
+}
+
+// where the history goes, BOOMSLANG_HISTORY can move it somewhere else
+func historyPath() string {
+	if path, ok := os.LookupEnv("BOOMSLANG_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".boomslang_history")
+}
+
+func (e *lineEditor) loadHistory() {
+	if e.histPath == "" {
+		return
+	}
+	buf, err := os.ReadFile(e.histPath)
+	if err != nil {
+		// no history yet, that is fine
+		return
+	}
+	for _, line := range strings.Split(string(buf), "\n") {
+		if strings.TrimSpace(line) != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > HISTORY_LIMIT {
+		e.history = e.history[len(e.history)-HISTORY_LIMIT:]
+	}
+}
+
+func (e *lineEditor) remember(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.histPath == "" {
+		return
+	}
+	file, err := os.OpenFile(e.histPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		// forgetting things is not worth interrupting anyone over
+		return
+	}
+	defer file.Close()
+	fmt.Fprintf(file, "%s\n", line)
+}
+
+// Reads one line, including the trailing newline like the other sources do
+func (e *lineEditor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt = prompt
+	e.line = e.line[:0]
+	e.cursor = 0
+	e.histPos = len(e.history)
+	e.redraw()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err == io.EOF && len(e.line) > 0 {
+			// hand over what we have, the next read will see EOF again
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprintf(e.out, "\n")
+			line := string(e.line)
+			e.remember(line)
+			return line + "\n", nil
+		case 1: // ctrl-a
+			e.cursor = 0
+		case 2: // ctrl-b
+			e.moveCursor(-1)
+		case 3: // ctrl-c abandons the line
+			fmt.Fprintf(e.out, "^C\n")
+			return "\n", nil
+		case 4: // ctrl-d
+			if len(e.line) == 0 {
+				return "", io.EOF
+			}
+			e.deleteAt(e.cursor)
+		case 5: // ctrl-e
+			e.cursor = len(e.line)
+		case 6: // ctrl-f
+			e.moveCursor(1)
+		case 11: // ctrl-k
+			e.line = e.line[:e.cursor]
+		case 21: // ctrl-u
+			e.line = e.line[e.cursor:]
+			e.cursor = 0
+		case 8, 127: // backspace
+			if e.cursor > 0 {
+				e.cursor -= 1
+				e.deleteAt(e.cursor)
+			}
+		case '\t':
+			e.completeWord()
+		case 27:
+			e.escapeSequence()
+		default:
+			if r >= ' ' {
+				e.insert(r)
+			}
+		}
+		e.redraw()
+	}
+
+	fmt.Fprintf(e.out, "\n")
+	return string(e.line), nil
+}
+
+func (e *lineEditor) escapeSequence() {
+	kind, _, err := e.in.ReadRune()
+	if err != nil || (kind != '[' && kind != 'O') {
+		return
+	}
+	code, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+	switch code {
+	case 'A':
+		e.walkHistory(-1)
+	case 'B':
+		e.walkHistory(1)
+	case 'C':
+		e.moveCursor(1)
+	case 'D':
+		e.moveCursor(-1)
+	case 'H':
+		e.cursor = 0
+	case 'F':
+		e.cursor = len(e.line)
+	case '3':
+		// delete is sent as ESC [ 3 ~
+		if tilde, _, err := e.in.ReadRune(); err == nil && tilde == '~' {
+			e.deleteAt(e.cursor)
+		}
+	}
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.line = append(e.line, 0)
+	copy(e.line[e.cursor+1:], e.line[e.cursor:])
+	e.line[e.cursor] = r
+	e.cursor += 1
+}
+
+func (e *lineEditor) deleteAt(pos int) {
+	if pos < 0 || pos >= len(e.line) {
+		return
+	}
+	e.line = append(e.line[:pos], e.line[pos+1:]...)
+}
+
+func (e *lineEditor) moveCursor(by int) {
+	e.cursor += by
+	if e.cursor < 0 {
+		e.cursor = 0
+	}
+	if e.cursor > len(e.line) {
+		e.cursor = len(e.line)
+	}
+}
+
+func (e *lineEditor) walkHistory(by int) {
+	pos := e.histPos + by
+	if pos < 0 || pos > len(e.history) {
+		return
+	}
+	e.histPos = pos
+	if pos == len(e.history) {
+		e.line = e.line[:0]
+	} else {
+		e.line = []rune(e.history[pos])
+	}
+	e.cursor = len(e.line)
+}
+
+// completes the word in front of the cursor,
+// as far as all of the candidates agree with each other
+func (e *lineEditor) completeWord() {
+	start := e.cursor
+	for start > 0 && e.line[start-1] != ' ' {
+		start -= 1
+	}
+	prefix := string(e.line[start:e.cursor])
+	candidates := e.complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	for _, r := range strings.TrimPrefix(common, prefix) {
+		e.insert(r)
+	}
+	if len(candidates) > 1 && common == prefix {
+		fmt.Fprintf(e.out, "\n%s\n", strings.Join(candidates, "  "))
+	}
+}
+
+func (e *lineEditor) redraw() {
+	fmt.Fprintf(e.out, "\r%s%s\033[K", e.prompt, string(e.line))
+	if back := len(e.line) - e.cursor; back > 0 {
+		fmt.Fprintf(e.out, "\033[%dD", back)
+	}
+}
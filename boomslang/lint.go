@@ -0,0 +1,352 @@
+package boomslang
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Linting: an opt-in safety net that looks for likely mistakes in the ast.
+// Any warning can be silenced with a comment at the end of its line,
+// either '# lint-ignore' for everything or '# lint-ignore: rule, rule' for some
+
+const (
+	LINT_UNASSIGNED_NAME    string = "unassigned-name"
+	LINT_UNUSED_NAME        string = "unused-name"
+	LINT_SHADOWED_BUILTIN   string = "shadowed-builtin"
+	LINT_UNREACHABLE_CODE   string = "unreachable-code"
+	LINT_CONSTANT_CONDITION string = "constant-condition"
+	LINT_STATIC_LOOP        string = "static-loop"
+)
+
+type LintWarning struct {
+	rule string
+	msg  string
+	spn  Span
+}
+
+func (w LintWarning) String() string {
+	return fmt.Sprintf("%s:%d:%d: [%s] %s", w.spn.SourceName, w.spn.Lineno, w.spn.Begin+1, w.rule, w.msg)
+}
+
+// Lints a whole program, reading it from text
+func LintProgram(opts *Opts, name string, text string) ([]LintWarning, error) {
+	source := FileSource{name, bufio.NewReader(strings.NewReader(text))}
+	lexer := MakeLexer(opts, source)
+	tokens, err := lexer.Lex()
+	if err != nil {
+		return nil, err
+	}
+	parser := MakeParser(opts, tokens)
+	ast, err := parser.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	l := linter{
+		builtins: make(map[string]bool),
+		borrowed: make(map[string]bool),
+		reported: make(map[string]bool),
+	}
+	env := MakeEnv(new(Opts))
+	LoadBuiltins(env)
+	LoadArguments(env, nil)
+	for _, name := range env.Names() {
+		l.builtins[name] = true
+	}
+
+	l.enter()
+	l.block(ast)
+	l.leave()
+
+	suppressed := make(map[int]string)
+	for _, comment := range lexer.Comments() {
+		suppressed[comment.Spn.Lineno] = comment.Lex
+	}
+	warnings := make([]LintWarning, 0, len(l.warnings))
+	for _, w := range l.warnings {
+		if !isSuppressed(suppressed[w.spn.Lineno], w.rule) {
+			warnings = append(warnings, w)
+		}
+	}
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i].spn, warnings[j].spn
+		if a.Lineno != b.Lineno {
+			return a.Lineno < b.Lineno
+		}
+		return a.Begin < b.Begin
+	})
+	return warnings, nil
+}
+
+func isSuppressed(comment string, rule string) bool {
+	_, directive, found := strings.Cut(comment, "lint-ignore")
+	if !found {
+		return false
+	}
+	directive = strings.TrimSpace(directive)
+	if !strings.HasPrefix(directive, ":") {
+		return true
+	}
+	for _, r := range strings.Split(strings.TrimPrefix(directive, ":"), ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+	return false
+}
+
+type linter struct {
+	builtins map[string]bool
+	borrowed map[string]bool // namespaces of borrowed modules, their names are not ours to check
+	reported map[string]bool // names already reported as unassigned
+	scope    *lintScope
+	warnings []LintWarning
+}
+
+// names are scoped like they are at runtime: every procedure body has a scope of its own,
+// and what it does not find there it looks up where the procedure was defined
+type lintScope struct {
+	outer    *lintScope
+	assigned map[string]Span // where each name was first assigned
+	reads    []AstIdent      // names looked up here, or in procedures defined here without finding them
+}
+
+func (l *linter) warn(rule string, spn Span, format string, args ...any) {
+	l.warnings = append(l.warnings, LintWarning{rule: rule, msg: fmt.Sprintf(format, args...), spn: spn})
+}
+
+func (l *linter) assign(ident AstIdent, what string) {
+	if l.builtins[ident.name] && !l.visible(ident.name) {
+		l.warn(LINT_SHADOWED_BUILTIN, ident.spn, "%s '%s' hides the builtin of the same name", what, ident.name)
+	}
+	if _, ok := l.scope.assigned[ident.name]; !ok {
+		l.scope.assigned[ident.name] = ident.spn
+	}
+}
+
+// whether the program gave name a value in this scope or one around it
+func (l *linter) visible(name string) bool {
+	for scope := l.scope; scope != nil; scope = scope.outer {
+		if _, ok := scope.assigned[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *linter) enter() {
+	l.scope = &lintScope{outer: l.scope, assigned: make(map[string]Span)}
+}
+
+// closes the innermost scope. Its names that were never looked up are unused,
+// what it looked up without having it is left to the scope around it
+func (l *linter) leave() {
+	scope := l.scope
+	used := make(map[string]bool)
+	for _, ident := range scope.reads {
+		if _, ok := scope.assigned[ident.name]; ok {
+			used[ident.name] = true
+		} else if scope.outer != nil {
+			scope.outer.reads = append(scope.outer.reads, ident)
+		} else {
+			l.unassigned(ident)
+		}
+	}
+	for name, spn := range scope.assigned {
+		if !used[name] {
+			l.warn(LINT_UNUSED_NAME, spn, "the name '%s' is given a value but never used", name)
+		}
+	}
+	l.scope = scope.outer
+}
+
+func (l *linter) unassigned(ident AstIdent) {
+	namespace, _, _ := strings.Cut(ident.name, " ")
+	if l.builtins[ident.name] || l.borrowed[namespace] || l.reported[ident.name] {
+		return
+	}
+	l.reported[ident.name] = true
+	l.warn(LINT_UNASSIGNED_NAME, ident.spn, "the name '%s' is used but never given a value", ident.name)
+}
+
+func (l *linter) block(ast []Ast) {
+	stopped, warned := false, false
+	for _, node := range ast {
+		if isBlank(node) {
+			continue
+		}
+		if stopped && !warned {
+			// one warning per block is plenty
+			l.warn(LINT_UNREACHABLE_CODE, node.Span(), "this statement can never run")
+			warned = true
+		}
+		l.stmnt(node)
+		switch node.(type) {
+		case AstReturns, AstBreak:
+			stopped = true
+		}
+	}
+}
+
+func (l *linter) stmnt(node Ast) {
+	switch n := node.(type) {
+	case AstAssign:
+		l.expr(n.rvalue)
+		if ident, ok := n.lvalue.(AstIdent); ok {
+			l.assign(ident, "name")
+		}
+	case AstFuncDef:
+		l.assign(n.name, "procedure")
+		l.enter()
+		for _, param := range n.params {
+			l.assign(param, "parameter")
+		}
+		l.block(n.body)
+		l.leave()
+	case AstIfStmnt:
+		l.condition(n.cond, "if statement")
+		l.block(n.if_block)
+		l.block(n.else_block)
+	case AstLoop:
+		if !l.condition(n.cond, "loop") && !mayChange(n.cond, n.block) {
+			l.warn(LINT_STATIC_LOOP, n.cond.Span(), "nothing in this loop changes its condition")
+		}
+		l.block(n.block)
+		l.block(n.else_block)
+	case AstReturns:
+		l.expr(n.expr)
+	case AstBorrow:
+		l.expr(n.path)
+		l.borrowed[n.name.name] = true
+	case AstBreak:
+	default:
+		l.expr(node)
+	}
+}
+
+// reports conditions that are always the same, returns whether it was one
+func (l *linter) condition(cond Ast, what string) bool {
+	l.expr(cond)
+	if lit, ok := cond.(AstLiteral); ok {
+		l.warn(LINT_CONSTANT_CONDITION, cond.Span(), "the condition of this %s is always %v", what, bsTruthy(lit.value))
+		return true
+	}
+	return false
+}
+
+func (l *linter) expr(node Ast) {
+	switch n := node.(type) {
+	case AstIdent:
+		l.scope.reads = append(l.scope.reads, n)
+	case AstFunCall:
+		l.expr(n.fun)
+		for _, arg := range n.args {
+			l.expr(arg)
+		}
+	}
+}
+
+// whether anything in the body could make the condition come out differently.
+// procedures can not reassign our names (they get their own scope),
+// but they can return something else every time, like ask does
+func mayChange(cond Ast, body []Ast) bool {
+	names := make(map[string]bool)
+	calls := false
+	var visit func(node Ast)
+	visit = func(node Ast) {
+		switch n := node.(type) {
+		case AstIdent:
+			names[n.name] = true
+		case AstFunCall:
+			if ident, ok := n.fun.(AstIdent); !ok || !isInfixBuiltin(ident.name) {
+				calls = true
+			}
+			for _, arg := range n.args {
+				visit(arg)
+			}
+		}
+	}
+	visit(cond)
+	return calls || assignsAny(body, names)
+}
+
+func assignsAny(ast []Ast, names map[string]bool) bool {
+	for _, node := range ast {
+		switch n := node.(type) {
+		case AstAssign:
+			if ident, ok := n.lvalue.(AstIdent); ok && names[ident.name] {
+				return true
+			}
+		case AstIfStmnt:
+			if assignsAny(n.if_block, names) || assignsAny(n.else_block, names) {
+				return true
+			}
+		case AstLoop:
+			if assignsAny(n.block, names) || assignsAny(n.else_block, names) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isInfixBuiltin(symbol string) bool {
+	for _, infix := range infixBuiltins {
+		if infix.symbol == symbol {
+			return true
+		}
+	}
+	return false
+}
+
+// ==========================================
+//
+//	boomslang lint [files...]
+//	  reports warnings for every file, with no files (or -) it lints stdin
+func runLint(opts *Opts, args []string) int {
+	files := make([]string, 0, len(args))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--") {
+			fmt.Fprintf(opts.estr, "Bad flag: I do not recognize %s\n", arg)
+			return EXIT_BAD_OPTS
+		}
+		files = append(files, arg)
+	}
+	if len(files) == 0 {
+		files = append(files, "-")
+	}
+
+	rc := 0
+	for _, filePath := range files {
+		var text []byte
+		var err error
+		if filePath == "-" {
+			text, err = io.ReadAll(opts.istr)
+		} else {
+			text, err = os.ReadFile(filePath)
+		}
+		if err != nil {
+			fmt.Fprintf(opts.estr, "Error opening file '%s': %s\n", filePath, err)
+			rc = EXIT_BAD_FILE
+			continue
+		}
+
+		warnings, err := LintProgram(opts, filePath, string(text))
+		if err != nil {
+			fmt.Fprintf(opts.estr, "\033[0;31m I am sorry, but I simply could not understand the file you gave me: %v\n\033[0m ", err)
+			rc = EXIT_PARSE_FAILURE
+			continue
+		}
+		for _, w := range warnings {
+			fmt.Fprintf(opts.ostr, "%s\n", w)
+		}
+		if len(warnings) > 0 && rc == 0 {
+			rc = EXIT_LINT_WARNINGS
+		}
+	}
+	return rc
+}
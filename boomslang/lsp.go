@@ -0,0 +1,669 @@
+package boomslang
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Language server: speaks LSP (JSON-RPC framed by Content-Length headers) on stdin and stdout,
+// so editors get diagnostics, hover, go to definition, symbols, completion and formatting.
+// Documents are always sent in full, Boomslang programs are not that big.
+// Columns are counted in bytes, which is what editors expect as long as programs stay ascii
+
+const (
+	LSP_PARSE_ERROR      int = -32700
+	LSP_INVALID_PARAMS   int = -32602
+	LSP_METHOD_NOT_FOUND int = -32601
+
+	LSP_SEVERITY_ERROR   int = 1
+	LSP_SEVERITY_WARNING int = 2
+
+	LSP_COMPLETION_FUNCTION int = 3
+	LSP_COMPLETION_VARIABLE int = 6
+	LSP_COMPLETION_KEYWORD  int = 14
+
+	LSP_SYMBOL_FUNCTION int = 12
+	LSP_SYMBOL_VARIABLE int = 13
+)
+
+var lspKeywords = []string{
+	"is", "if", "otherwise", "otif", "of", "the", "while", "break",
+	"by", "we mean", "returns", "text", "true", "false",
+}
+
+// both directions use the same envelope, requests have an id and a method,
+// notifications only a method, and responses an id with a result or an error
+type lspMessage struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	Id      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *lspError       `json:"error,omitempty"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspLocation struct {
+	Uri   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspTextDocument struct {
+	Uri  string `json:"uri"`
+	Text string `json:"text,omitempty"`
+}
+
+type lspDocumentParams struct {
+	TextDocument   lspTextDocument `json:"textDocument"`
+	Position       lspPosition     `json:"position"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type lspHover struct {
+	Contents struct {
+		Kind  string `json:"kind"`
+		Value string `json:"value"`
+	} `json:"contents"`
+	Range lspRange `json:"range"`
+}
+
+type lspSymbol struct {
+	Name           string      `json:"name"`
+	Kind           int         `json:"kind"`
+	Range          lspRange    `json:"range"`
+	SelectionRange lspRange    `json:"selectionRange"`
+	Children       []lspSymbol `json:"children,omitempty"`
+}
+
+type lspCompletion struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspServer struct {
+	opts     *Opts
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]*lspDocument
+	builtins map[string]bool
+	shutdown bool
+}
+
+// an open document, along with what we last managed to make of it.
+// while someone is typing the text rarely parses, so the index is only replaced when it does
+type lspDocument struct {
+	text  string
+	index *lspIndex
+}
+
+func makeLspServer(opts *Opts) *lspServer {
+	s := new(lspServer)
+	s.opts = opts
+	s.in = bufio.NewReader(opts.istr)
+	s.out = opts.ostr
+	s.docs = make(map[string]*lspDocument)
+	s.builtins = make(map[string]bool)
+
+	env := MakeEnv(new(Opts))
+	LoadBuiltins(env)
+	LoadArguments(env, nil)
+	for _, name := range env.Names() {
+		s.builtins[name] = true
+	}
+	return s
+}
+
+// ==========================================
+//
+//	boomslang lsp
+//	  serves one editor on stdin and stdout until it says goodbye
+func runLsp(opts *Opts, args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintf(opts.estr, "Bad flag: I do not recognize %s\n", args[0])
+		return EXIT_BAD_OPTS
+	}
+	return makeLspServer(opts).serve()
+}
+
+func (s *lspServer) serve() int {
+	for {
+		msg, err := s.read()
+		if err == io.EOF {
+			// the editor went away without asking us to exit
+			return 1
+		}
+		if err != nil {
+			s.respondError(json.RawMessage("null"), LSP_PARSE_ERROR, err.Error())
+			continue
+		}
+		if msg.Method == "exit" {
+			if s.shutdown {
+				return 0
+			}
+			return 1
+		}
+		s.handle(msg)
+	}
+}
+
+func (s *lspServer) read() (*lspMessage, error) {
+	body, err := readFrame(s.in)
+	if err != nil {
+		return nil, err
+	}
+	msg := new(lspMessage)
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *lspServer) write(msg lspMessage) {
+	msg.Jsonrpc = "2.0"
+	body, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	writeFrame(s.out, body)
+}
+
+// Both the language server and the debug adapter put a Content-Length header
+// in front of every message. io.EOF means the other side went away
+func readFrame(in *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return nil, io.EOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("bad Content-Length '%s'", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without a Content-Length")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(in, body); err != nil {
+		return nil, io.EOF
+	}
+	return body, nil
+}
+
+func writeFrame(out io.Writer, body []byte) {
+	fmt.Fprintf(out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *lspServer) respond(id json.RawMessage, result any) {
+	body, err := json.Marshal(result)
+	if err != nil {
+		panic(err)
+	}
+	s.write(lspMessage{Id: id, Result: body})
+}
+
+func (s *lspServer) respondError(id json.RawMessage, code int, message string) {
+	s.write(lspMessage{Id: id, Error: &lspError{Code: code, Message: message}})
+}
+
+func (s *lspServer) notify(method string, params any) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		panic(err)
+	}
+	s.write(lspMessage{Method: method, Params: body})
+}
+
+func (s *lspServer) handle(msg *lspMessage) {
+	var params lspDocumentParams
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			if msg.Id != nil {
+				s.respondError(msg.Id, LSP_INVALID_PARAMS, err.Error())
+			}
+			return
+		}
+	}
+	uri := params.TextDocument.Uri
+
+	switch msg.Method {
+	case "initialize":
+		s.respond(msg.Id, map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":           1, // always the full text
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"documentSymbolProvider":     true,
+				"completionProvider":         map[string]any{},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "boomslang"},
+		})
+	case "shutdown":
+		s.shutdown = true
+		s.respond(msg.Id, nil)
+	case "textDocument/didOpen":
+		s.update(uri, params.TextDocument.Text)
+	case "textDocument/didChange":
+		if n := len(params.ContentChanges); n > 0 {
+			s.update(uri, params.ContentChanges[n-1].Text)
+		}
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": []lspDiagnostic{}})
+	case "textDocument/hover":
+		s.respond(msg.Id, s.hover(uri, params.Position))
+	case "textDocument/definition":
+		s.respond(msg.Id, s.definition(uri, params.Position))
+	case "textDocument/documentSymbol":
+		s.respond(msg.Id, s.symbols(uri))
+	case "textDocument/completion":
+		s.respond(msg.Id, s.completion(uri))
+	case "textDocument/formatting":
+		s.respond(msg.Id, s.formatting(uri))
+	default:
+		// notifications we do not care about are fine to ignore, requests are not
+		if msg.Id != nil {
+			s.respondError(msg.Id, LSP_METHOD_NOT_FOUND, "I do not know how to "+msg.Method)
+		}
+	}
+}
+
+// takes in new text for a document and tells the editor what is wrong with it
+func (s *lspServer) update(uri string, text string) {
+	doc, ok := s.docs[uri]
+	if !ok {
+		doc = new(lspDocument)
+		s.docs[uri] = doc
+	}
+	doc.text = text
+
+	diagnostics := []lspDiagnostic{}
+	ast, err := parseText(s.opts, uri, text)
+	if err != nil {
+		diagnostics = append(diagnostics, lspDiagnostic{
+			Range:    errorRange(err, text),
+			Severity: LSP_SEVERITY_ERROR,
+			Source:   "boomslang",
+			Message:  errorMessage(err),
+		})
+	} else {
+		doc.index = indexProgram(ast, text)
+		warnings, _ := LintProgram(s.opts, uri, text)
+		for _, w := range warnings {
+			diagnostics = append(diagnostics, lspDiagnostic{
+				Range:    spanRange(w.spn),
+				Severity: LSP_SEVERITY_WARNING,
+				Source:   "boomslang lint",
+				Message:  fmt.Sprintf("%s [%s]", w.msg, w.rule),
+			})
+		}
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diagnostics})
+}
+
+func parseText(opts *Opts, name string, text string) ([]Ast, error) {
+	source := FileSource{name, bufio.NewReader(strings.NewReader(text))}
+	tokens, err := MakeLexer(opts, source).Lex()
+	if err != nil {
+		return nil, err
+	}
+	return MakeParser(opts, tokens).Parse()
+}
+
+func errorMessage(err error) string {
+	var parseErr ParseError
+	var lexErr LexError
+	if errors.As(err, &parseErr) {
+		return parseErr.msg
+	} else if errors.As(err, &lexErr) {
+		return lexErr.msg
+	}
+	return err.Error()
+}
+
+// parse errors point at a token, lex errors only know their line
+func errorRange(err error, text string) lspRange {
+	var parseErr ParseError
+	var lexErr LexError
+	lineno := 1
+	if errors.As(err, &parseErr) {
+		if parseErr.token.Spn.Lineno > 0 {
+			return spanRange(parseErr.token.Spn)
+		}
+	} else if errors.As(err, &lexErr) {
+		lineno = lexErr.spn.Lineno
+	}
+	lines := strings.Split(text, "\n")
+	lineno = min(max(lineno, 1), len(lines))
+	return lspRange{
+		Start: lspPosition{lineno - 1, 0},
+		End:   lspPosition{lineno - 1, len(strings.TrimRight(lines[lineno-1], "\r"))},
+	}
+}
+
+func spanRange(spn Span) lspRange {
+	line := max(spn.Lineno-1, 0)
+	return lspRange{Start: lspPosition{line, spn.Begin}, End: lspPosition{line, spn.End}}
+}
+
+func (s *lspServer) index(uri string) *lspIndex {
+	if doc, ok := s.docs[uri]; ok && doc.index != nil {
+		return doc.index
+	}
+	return new(lspIndex)
+}
+
+func (s *lspServer) hover(uri string, pos lspPosition) *lspHover {
+	index := s.index(uri)
+	ref, ok := index.at(pos)
+	if !ok {
+		return nil
+	}
+
+	var value string
+	if def, ok := index.definition(ref); ok {
+		switch n := def.node.(type) {
+		case AstFuncDef:
+			if def.ident.name == n.name.name && def.ident.spn == n.name.spn {
+				value = formatFunDef(n)
+			} else {
+				value = fmt.Sprintf("the %s\n# given to '%s'", def.ident.name, n.name.name)
+			}
+		case AstAssign:
+			value = formatExpr(n.lvalue) + " is " + formatExpr(n.rvalue)
+		}
+	} else if s.builtins[ref.ident.name] {
+		value = "# builtin procedure\n" + displayName(ref.ident.name)
+	}
+	if value == "" {
+		return nil
+	}
+
+	hover := new(lspHover)
+	hover.Contents.Kind = "markdown"
+	hover.Contents.Value = "```boomslang\n" + value + "\n```"
+	hover.Range = spanRange(ref.ident.spn)
+	return hover
+}
+
+func (s *lspServer) definition(uri string, pos lspPosition) *lspLocation {
+	index := s.index(uri)
+	ref, ok := index.at(pos)
+	if !ok {
+		return nil
+	}
+	def, ok := index.definition(ref)
+	if !ok {
+		return nil
+	}
+	return &lspLocation{Uri: uri, Range: spanRange(def.ident.spn)}
+}
+
+func (s *lspServer) symbols(uri string) []lspSymbol {
+	return s.index(uri).symbols
+}
+
+func (s *lspServer) completion(uri string) []lspCompletion {
+	items := make([]lspCompletion, 0, len(lspKeywords)+len(s.builtins))
+	for _, kw := range lspKeywords {
+		items = append(items, lspCompletion{Label: kw, Kind: LSP_COMPLETION_KEYWORD, Detail: "keyword"})
+	}
+
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(s.builtins))
+	for name := range s.builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.HasPrefix(name, "_") && !isInfixBuiltin(name) {
+			continue
+		}
+		seen[name] = true
+		items = append(items, lspCompletion{Label: displayName(name), Kind: LSP_COMPLETION_FUNCTION, Detail: "builtin"})
+	}
+	for _, def := range s.index(uri).defs {
+		if seen[def.ident.name] {
+			continue
+		}
+		seen[def.ident.name] = true
+		kind := LSP_COMPLETION_VARIABLE
+		if n, ok := def.node.(AstFuncDef); ok && n.name.spn == def.ident.spn {
+			kind = LSP_COMPLETION_FUNCTION
+		}
+		items = append(items, lspCompletion{Label: def.ident.name, Kind: kind})
+	}
+	return items
+}
+
+func (s *lspServer) formatting(uri string) []lspTextEdit {
+	doc, ok := s.docs[uri]
+	if !ok {
+		return nil
+	}
+	formatted, err := FormatProgram(s.opts, uri, doc.text)
+	if err != nil || formatted == doc.text {
+		// what is wrong with it is already in the diagnostics
+		return []lspTextEdit{}
+	}
+	lines := strings.Split(doc.text, "\n")
+	whole := lspRange{End: lspPosition{len(lines) - 1, len(lines[len(lines)-1])}}
+	return []lspTextEdit{{Range: whole, NewText: formatted}}
+}
+
+// infix builtins are known by their operator
+func displayName(name string) string {
+	for _, infix := range infixBuiltins {
+		if infix.symbol == name {
+			return infix.opname
+		}
+	}
+	return name
+}
+
+// ==========================================
+// what the editor features need to know about a program:
+// every name that is mentioned, where names get their values, and the outline
+
+type lspIndex struct {
+	refs    []lspName
+	defs    []lspName
+	symbols []lspSymbol
+	lines   []string
+}
+
+type lspName struct {
+	ident AstIdent
+	node  Ast // the assignment or procedure definition giving the name its value
+	// the lines of the procedure the name belongs to, names outside of any have all of them
+	first int
+	last  int
+}
+
+func indexProgram(ast []Ast, text string) *lspIndex {
+	x := new(lspIndex)
+	x.lines = strings.Split(text, "\n")
+	x.symbols = x.block(ast, 0, math.MaxInt, make(map[string]bool))
+	if x.symbols == nil {
+		x.symbols = []lspSymbol{}
+	}
+	return x
+}
+
+// indexes a block, returning the symbols for the outline.
+// seen keeps names from showing up in the outline every time they are assigned
+func (x *lspIndex) block(ast []Ast, first int, last int, seen map[string]bool) []lspSymbol {
+	var symbols []lspSymbol
+	for _, node := range ast {
+		switch n := node.(type) {
+		case AstAssign:
+			x.expr(n.rvalue, first, last)
+			if ident, ok := n.lvalue.(AstIdent); ok {
+				x.define(ident, n, first, last)
+				if !seen[ident.name] {
+					seen[ident.name] = true
+					symbols = append(symbols, lspSymbol{
+						Name:           ident.name,
+						Kind:           LSP_SYMBOL_VARIABLE,
+						Range:          spanRange(n.spn),
+						SelectionRange: spanRange(ident.spn),
+					})
+				}
+			}
+		case AstFuncDef:
+			x.define(n.name, n, first, last)
+			end := lastLine(n.body, n.spn.Lineno)
+			inner := make(map[string]bool)
+			var children []lspSymbol
+			for _, param := range n.params {
+				x.define(param, n, n.spn.Lineno, end)
+				inner[param.name] = true
+				children = append(children, lspSymbol{
+					Name:           param.name,
+					Kind:           LSP_SYMBOL_VARIABLE,
+					Range:          spanRange(param.spn),
+					SelectionRange: spanRange(param.spn),
+				})
+			}
+			children = append(children, x.block(n.body, n.spn.Lineno, end, inner)...)
+			symbols = append(symbols, lspSymbol{
+				Name:           n.name.name,
+				Kind:           LSP_SYMBOL_FUNCTION,
+				Range:          x.linesRange(n.spn, end),
+				SelectionRange: spanRange(n.name.spn),
+				Children:       children,
+			})
+		case AstIfStmnt:
+			x.expr(n.cond, first, last)
+			symbols = append(symbols, x.block(n.if_block, first, last, seen)...)
+			symbols = append(symbols, x.block(n.else_block, first, last, seen)...)
+		case AstLoop:
+			x.expr(n.cond, first, last)
+			symbols = append(symbols, x.block(n.block, first, last, seen)...)
+			symbols = append(symbols, x.block(n.else_block, first, last, seen)...)
+		case AstReturns:
+			x.expr(n.expr, first, last)
+		default:
+			x.expr(node, first, last)
+		}
+	}
+	return symbols
+}
+
+func (x *lspIndex) expr(node Ast, first int, last int) {
+	switch n := node.(type) {
+	case AstIdent:
+		x.refs = append(x.refs, lspName{ident: n, first: first, last: last})
+	case AstFunCall:
+		x.expr(n.fun, first, last)
+		for _, arg := range n.args {
+			x.expr(arg, first, last)
+		}
+	}
+}
+
+// a definition is also a mention, so hovering over it works too
+func (x *lspIndex) define(ident AstIdent, node Ast, first int, last int) {
+	name := lspName{ident: ident, node: node, first: first, last: last}
+	x.defs = append(x.defs, name)
+	x.refs = append(x.refs, name)
+}
+
+// the name mentioned at a position, if any
+func (x *lspIndex) at(pos lspPosition) (lspName, bool) {
+	for _, ref := range x.refs {
+		spn := ref.ident.spn
+		if spn.Lineno-1 == pos.Line && spn.Begin <= pos.Character && pos.Character <= spn.End {
+			return ref, true
+		}
+	}
+	return lspName{}, false
+}
+
+// where a name got its value: the closest procedure around it wins, then the earliest line
+func (x *lspIndex) definition(ref lspName) (lspName, bool) {
+	line := ref.ident.spn.Lineno
+	var best lspName
+	found := false
+	for _, def := range x.defs {
+		if def.ident.name != ref.ident.name || line < def.first || line > def.last {
+			continue
+		}
+		if !found || def.first > best.first {
+			best, found = def, true
+		}
+	}
+	return best, found
+}
+
+// from the start of spn to the end of line last
+func (x *lspIndex) linesRange(spn Span, last int) lspRange {
+	end := lspPosition{last - 1, 0}
+	if last-1 < len(x.lines) {
+		end.Character = len(strings.TrimRight(x.lines[last-1], "\r"))
+	}
+	return lspRange{Start: spanRange(spn).Start, End: end}
+}
+
+// the last line of a block, counting the blocks inside of it
+func lastLine(ast []Ast, last int) int {
+	for _, node := range ast {
+		if isBlank(node) {
+			continue
+		}
+		last = max(last, node.Span().Lineno)
+		switch n := node.(type) {
+		case AstFuncDef:
+			last = lastLine(n.body, last)
+		case AstIfStmnt:
+			last = lastLine(n.else_block, lastLine(n.if_block, last))
+		case AstLoop:
+			last = lastLine(n.else_block, lastLine(n.block, last))
+		}
+	}
+	return last
+}
@@ -0,0 +1,1801 @@
+package boomslang
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testcase struct {
+	filePath string
+	expected string
+}
+
+const TESTCASES_DIR string = "../testcases"
+const EXAMPLES_DIR string = "../examples"
+const STDLIB_TESTS_DIR string = "stdlib/tests"
+
+func readFile(filePath string) string {
+	buf, err := os.ReadFile(filePath)
+	if err != nil {
+		panic(err)
+	}
+	return string(buf)
+}
+
+// a program for an Interpreter, and the result it should give back
+type evalCase struct {
+	program  string
+	expected any
+}
+
+// runs the cases one after the other in the same interpreter
+func evalCases(t *testing.T, interp *Interpreter, cases []evalCase) {
+	t.Helper()
+	for _, c := range cases {
+		result, err := interp.Eval(context.Background(), c.program)
+		if err != nil {
+			t.Fatalf("%q failed: %v", c.program, err)
+		}
+		if !reflect.DeepEqual(result, c.expected) {
+			t.Errorf("%q: expected %#v, got %#v", c.program, c.expected, result)
+		}
+	}
+}
+
+// runs a program that should fail, and gives back what it failed with
+func evalFailure(t *testing.T, interp *Interpreter, program string) BsValue {
+	t.Helper()
+	_, err := interp.Eval(context.Background(), program)
+	var runtimeErr RuntimeError
+	if !errors.As(err, &runtimeErr) {
+		t.Fatalf("expected %q to fail, got %v", program, err)
+	}
+	return unwindCause(runtimeErr.Failure)
+}
+
+func TestExamples(t *testing.T) {
+	runExamples(t, TESTCASES_DIR)
+}
+
+// the standard library keeps its own tests next to it, in the same format
+func TestStdlib(t *testing.T) {
+	runExamples(t, STDLIB_TESTS_DIR)
+}
+
+// programs can only make lists of texts, lists of numbers come in from Go
+func TestStdlibNumberLists(t *testing.T) {
+	interp := NewInterpreter(Options{})
+	interp.SetGlobal("numbers", []int64{3, 9, 4, 9})
+	interp.SetGlobal("none", []int64{})
+	evalCases(t, interp, []evalCase{
+		{"returns sum of the numbers\n", int64(25)},
+		{"returns occurrences of the numbers and 9\n", int64(2)},
+		{"returns contains of the numbers and 4\n", true},
+		{"returns contains of the numbers and 5\n", false},
+		{"returns largest of the numbers\n", int64(9)},
+		{"returns last of the numbers\n", int64(9)},
+		{"returns largest of the none\n", nil},
+		{"returns last of the none\n", nil},
+		// the procedures do not change the list they were given
+		{"returns length the numbers\n", int64(4)},
+	})
+}
+
+// runs every .bs file in dir, comparing what it shows with the .bs.stdout file next to it
+func runExamples(t *testing.T, dir string) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".bs") {
+			continue
+		}
+		t.Run(file.Name(), func(t *testing.T) {
+			expected := readFile(dir + "/" + file.Name() + ".stdout")
+
+			buf := new(strings.Builder)
+			opts := new(Opts)
+			opts.ostr = buf
+			opts.estr = buf
+			// programs that pick at random pick the same every time
+			opts.seed, opts.hasSeed = 1, true
+
+			rc := execute(opts, dir+"/"+file.Name())
+
+			if rc > 0 {
+				t.Errorf("program '%s' executed with nonzero exit ckde: %d", file.Name(), rc)
+			}
+
+			actual := buf.String()
+
+			if expected != actual {
+				t.Errorf("ran '%s' expected '%s', got '%s'", file.Name(), expected, actual)
+			}
+
+		})
+	}
+}
+
+func TestForwardedArguments(t *testing.T) {
+	opts := parse_opts([]string{"script.bs", "--debug=lex", "one", "--", "--two"})
+	if opts.filePath != "script.bs" {
+		t.Errorf("expected file path 'script.bs', got '%s'", opts.filePath)
+	}
+	if strings.Join(opts.args, " ") != "one --two" {
+		t.Errorf("expected arguments 'one --two', got %v", opts.args)
+	}
+	if opts.debug != DBG_LEX {
+		t.Errorf("expected only lex debugging, got %v", opts.debug)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	filePath := t.TempDir() + "/exit.bs"
+	program := "the remaining is the arguments\n" +
+		"while the remaining\n" +
+		"\tshow of first of the remaining\n" +
+		"\tthe remaining is rest of the remaining\n" +
+		"exit of 3\n" +
+		"show text never happening\n"
+	if err := os.WriteFile(filePath, []byte(program), 0644); err != nil {
+		panic(err)
+	}
+
+	buf := new(strings.Builder)
+	opts := new(Opts)
+	opts.ostr = buf
+	opts.estr = buf
+	opts.args = []string{"hello", "world"}
+
+	rc := execute(opts, filePath)
+
+	if rc != 3 {
+		t.Errorf("expected exit status 3, got %d", rc)
+	}
+	if buf.String() != "hello\nworld\n" {
+		t.Errorf("expected the arguments to be shown, got '%s'", buf.String())
+	}
+}
+
+func TestStdinProgram(t *testing.T) {
+	buf := new(strings.Builder)
+	opts := new(Opts)
+	opts.istr = strings.NewReader("the answer is 40 plus 2\nshow the answer")
+	opts.ostr = buf
+	opts.estr = buf
+
+	rc := execute(opts, "-")
+
+	if rc != 0 {
+		t.Errorf("program from stdin executed with nonzero exit code: %d", rc)
+	}
+	if buf.String() != "42\n" {
+		t.Errorf("expected '42', got '%s'", buf.String())
+	}
+}
+
+func TestInlineProgram(t *testing.T) {
+	opts := parse_opts([]string{"-e", "show the arguments", "a", "b"})
+	if !opts.hasInline || opts.filePath != "" {
+		t.Fatalf("expected an inline program, got %#v", opts)
+	}
+
+	buf := new(strings.Builder)
+	opts.ostr = buf
+	opts.estr = buf
+
+	rc := executeSource(opts, MakeReaderSource("<inline>", strings.NewReader(opts.inline)))
+
+	if rc != 0 {
+		t.Errorf("inline program executed with nonzero exit code: %d", rc)
+	}
+	if buf.String() != "[a, b]\n" {
+		t.Errorf("expected '[a, b]', got '%s'", buf.String())
+	}
+}
+
+func TestShebang(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, program string) string {
+		filePath := dir + "/" + name
+		if err := os.WriteFile(filePath, []byte(program), 0755); err != nil {
+			panic(err)
+		}
+		return filePath
+	}
+
+	withShebang := write("greet", "#!/usr/bin/env boomslang\nshow text hello\n")
+	withoutShebang := write("plain", "show text hello\n")
+	badSecondLine := write("broken", "#!/usr/bin/env boomslang\nby nothing we mean\n")
+
+	cases := []struct {
+		filePath string
+		anyExt   bool
+		rc       int
+		output   string
+	}{
+		{withShebang, false, 0, "hello\n"},
+		{withoutShebang, false, EXIT_BAD_FILE, "Bad file extension"},
+		{withoutShebang, true, 0, "hello\n"},
+		{badSecondLine, false, EXIT_PARSE_FAILURE, "broken:2"},
+	}
+	for _, c := range cases {
+		buf := new(strings.Builder)
+		opts := new(Opts)
+		opts.ostr = buf
+		opts.estr = buf
+		opts.anyExt = c.anyExt
+
+		rc := execute(opts, c.filePath)
+
+		if rc != c.rc {
+			t.Errorf("running '%s' expected exit code %d, got %d", c.filePath, c.rc, rc)
+		}
+		if !strings.Contains(buf.String(), c.output) {
+			t.Errorf("running '%s' expected output containing '%s', got '%s'", c.filePath, c.output, buf.String())
+		}
+	}
+
+	// the shebang is skipped as the first line of the file, not kept as a comment
+	lexer := MakeLexer(new(Opts), MakePreprocessor(new(Opts), FileSource{withShebang, bufio.NewReader(strings.NewReader(readFile(withShebang)))}))
+	if _, err := lexer.Lex(); err != nil {
+		t.Fatalf("expected '%s' to lex, got %v", withShebang, err)
+	}
+	if comments := lexer.Comments(); len(comments) != 0 {
+		t.Errorf("expected no comments in '%s', got %v", withShebang, comments)
+	}
+}
+
+func TestRepl(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		rc       int
+		limits   evalLimits
+		expected []string
+		missing  []string
+	}{
+		{
+			name:     "whole lines",
+			input:    "show text hello world\n",
+			expected: []string{"hello world\n"},
+		},
+		{
+			name: "blocks",
+			input: "the x is 0\n" +
+				"while the x smallerthan 3\n" +
+				"\tshow the x\n" +
+				"\tthe x is the x plus 1\n" +
+				"\n" +
+				"by double of n we mean\n" +
+				"\treturns the n plus the n\n" +
+				"\n" +
+				"show of double of 21\n",
+			expected: []string{"... ", "0\n1\n2\n", "42\n"},
+		},
+		{
+			name:    "exit command",
+			input:   "exit\nshow text never happening\n",
+			missing: []string{"never happening"},
+		},
+		{
+			name:    "exit builtin",
+			input:   "exit of 4\nshow text never happening\n",
+			rc:      4,
+			missing: []string{"never happening"},
+		},
+		{
+			name:     "failures do not end the session",
+			input:    "show the nobody\nshow text still here\n",
+			expected: []string{"failed to find the name 'nobody'", "still here\n"},
+		},
+		{
+			name:     "limits hold for every statement",
+			input:    "while true\n\tthe a is 1\n\nshow text still here\n",
+			limits:   evalLimits{maxSteps: 1000},
+			expected: []string{"(TimeoutError)", "still here\n"},
+		},
+		{
+			name:     "colon commands after a statement with a timeout",
+			input:    "the x is 1\n:type the x\n:reset\nthe y is 2\nshow the y\n",
+			limits:   evalLimits{timeout: 5 * time.Second, maxNames: 1},
+			expected: []string{"number\n", "all forgotten\n", "2\n"},
+			missing:  []string{"(TimeoutError)", "(ResourceError)"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buf := new(strings.Builder)
+			opts := new(Opts)
+			opts.istr = strings.NewReader(c.input)
+			opts.ostr = buf
+			opts.estr = buf
+			opts.limits = c.limits
+
+			rc := repl(opts)
+
+			if rc != c.rc {
+				t.Errorf("expected repl to exit with %d, got %d", c.rc, rc)
+			}
+			actual := buf.String()
+			for _, expected := range c.expected {
+				if !strings.Contains(actual, expected) {
+					t.Errorf("expected repl output to contain '%s', got '%s'", expected, actual)
+				}
+			}
+			for _, missing := range c.missing {
+				if strings.Contains(actual, missing) {
+					t.Errorf("expected repl output not to contain '%s', got '%s'", missing, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestReplMetaCommands(t *testing.T) {
+	input := "the answer is 42\n" +
+		":names ans\n" +
+		":type the answer plus 1\n" +
+		":type text hi\n" +
+		":tokens show text hi\n" +
+		":ast the answer is 1\n" +
+		":debug parse\n" +
+		":debug parse\n" +
+		":load " + TESTCASES_DIR + "/sums.bs\n" +
+		":reset\n" +
+		"show the answer\n" +
+		":nonsense\n" +
+		":quit\n" +
+		"show text never happening\n"
+	expected := []string{
+		"answer => 42\n",
+		"number\n",
+		"text\n",
+		"TOKEN_TEXT           \"hi\"\n",
+		"boomslang.AstAssign",
+		"debugging lex: false, parse: true, eval: false\n",
+		"debugging lex: false, parse: false, eval: false\n",
+		"3\n",
+		"all forgotten\n",
+		"failed to find the name 'answer'",
+		"I do not know the command ':nonsense'",
+	}
+
+	buf := new(strings.Builder)
+	opts := new(Opts)
+	opts.istr = strings.NewReader(input)
+	opts.ostr = buf
+	opts.estr = buf
+
+	rc := repl(opts)
+
+	if rc != 0 {
+		t.Errorf("expected repl to exit with 0, got %d", rc)
+	}
+	actual := buf.String()
+	for _, e := range expected {
+		if !strings.Contains(actual, e) {
+			t.Errorf("expected repl output to contain '%s', got '%s'", e, actual)
+		}
+	}
+	if strings.Contains(actual, "never happening") {
+		t.Errorf("expected :quit to leave the repl, got '%s'", actual)
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	histPath := t.TempDir() + "/history"
+	if err := os.WriteFile(histPath, []byte("show text from last time\n"), 0600); err != nil {
+		panic(err)
+	}
+
+	keys := "sh\t text helox" + // completion
+		"\177\033[Dl\033[C\r" + // backspace, left, right
+		"\033[A\033[A\r" + // history from the previous session
+		"\033[A\001\004\005!\r" + // ctrl-a, ctrl-d deletes, ctrl-e
+		"abc\003" + // ctrl-c drops the line
+		"\004" // ctrl-d on an empty line
+	e := makeLineEditor(bufio.NewReader(strings.NewReader(keys)), io.Discard, -1, histPath)
+	e.complete = func(prefix string) []string {
+		if strings.HasPrefix("show", prefix) {
+			return []string{"show"}
+		}
+		return nil
+	}
+
+	expected := []string{
+		"show text hello\n",
+		"show text from last time\n",
+		"how text from last time!\n",
+		"\n",
+	}
+	for _, want := range expected {
+		line, err := e.ReadLine("> ")
+		if err != nil {
+			t.Fatalf("expected '%s', got error %v", want, err)
+		}
+		if line != want {
+			t.Errorf("expected line '%q', got '%q'", want, line)
+		}
+	}
+	if _, err := e.ReadLine("> "); err != io.EOF {
+		t.Errorf("expected EOF after ctrl-d, got %v", err)
+	}
+
+	history := readFile(histPath)
+	if history != "show text from last time\nshow text hello\nshow text from last time\nhow text from last time!\n" {
+		t.Errorf("expected new lines to be appended to the history, got '%s'", history)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	for _, dir := range []string{TESTCASES_DIR, EXAMPLES_DIR} {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			panic(err)
+		}
+		for _, file := range files {
+			if !strings.HasSuffix(file.Name(), ".bs") {
+				continue
+			}
+			filePath := dir + "/" + file.Name()
+			t.Run(filePath, func(t *testing.T) {
+				opts := new(Opts)
+				formatted, err := FormatProgram(opts, filePath, readFile(filePath))
+				if err != nil {
+					t.Fatalf("could not format '%s': %v", filePath, err)
+				}
+				again, err := FormatProgram(opts, filePath, formatted)
+				if err != nil {
+					t.Fatalf("could not format the formatted '%s': %v", filePath, err)
+				}
+				if again != formatted {
+					t.Errorf("formatting '%s' twice changed it again, from '%s' to '%s'", filePath, formatted, again)
+				}
+
+				if dir != TESTCASES_DIR {
+					return
+				}
+				expected := readFile(filePath + ".stdout")
+				buf := new(strings.Builder)
+				opts.ostr = buf
+				opts.estr = buf
+				opts.seed, opts.hasSeed = 1, true
+				rc := executeSource(opts, MakeReaderSource(filePath, strings.NewReader(formatted)))
+				if rc != 0 || buf.String() != expected {
+					t.Errorf("formatted '%s' behaves differently (exit code %d), expected '%s', got '%s'", filePath, rc, expected, buf.String())
+				}
+			})
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	messy := "#!/usr/bin/env boomslang  \n" +
+		"\n" +
+		"the   count  is 0   \n" +
+		"while the count smallerthan 3\n" +
+		"    show  the count\n" +
+		"\n" +
+		"\n" +
+		"\tif the count equals 1\n" +
+		"\t    show text one   \n" +
+		"    otherwise\n" +
+		"\t\tif true\n" +
+		"\t\t    show text other\n" +
+		"    the count is the count plus 1\n" +
+		"\n\n"
+	expected := "#!/usr/bin/env boomslang\n" +
+		"the count is 0\n" +
+		"while the count smallerthan 3\n" +
+		"\tshow the count\n" +
+		"\n" +
+		"\tif the count equals 1\n" +
+		"\t\tshow text one\n" +
+		"\totif true\n" +
+		"\t\tshow text other\n" +
+		"\tthe count is the count plus 1\n"
+
+	dir := t.TempDir()
+	filePath := dir + "/messy.bs"
+	if err := os.WriteFile(filePath, []byte(messy), 0644); err != nil {
+		panic(err)
+	}
+
+	buf := new(strings.Builder)
+	opts := new(Opts)
+	opts.ostr = buf
+	opts.estr = buf
+
+	if rc := runFmt(opts, []string{"--check", filePath}); rc != EXIT_NOT_FORMATTED {
+		t.Errorf("expected --check to fail with %d on a messy file, got %d", EXIT_NOT_FORMATTED, rc)
+	}
+	if rc := runFmt(opts, []string{filePath}); rc != 0 {
+		t.Errorf("expected formatting to succeed, got %d: %s", rc, buf.String())
+	}
+	if actual := readFile(filePath); actual != expected {
+		t.Errorf("expected formatted file '%s', got '%s'", expected, actual)
+	}
+	if rc := runFmt(opts, []string{"--check", filePath}); rc != 0 {
+		t.Errorf("expected --check to pass on a formatted file, got %d", rc)
+	}
+}
+
+func TestLint(t *testing.T) {
+	program := "by show of it we mean\n" +
+		"\treturns it\n" +
+		"\tshow of it\n" +
+		"the count is 0\n" +
+		"the unused is 1\n" +
+		"the ignored is 2 # lint-ignore: unused-name\n" +
+		"if true\n" +
+		"\tshow of the missing\n" +
+		"while the count smallerthan 3\n" +
+		"\tdebug of the count\n"
+	expected := []string{
+		"lint.bs:1:4: [shadowed-builtin] procedure 'show' hides the builtin of the same name",
+		"lint.bs:3:2: [unreachable-code] this statement can never run",
+		"lint.bs:5:1: [unused-name] the name 'unused' is given a value but never used",
+		"lint.bs:7:4: [constant-condition] the condition of this if statement is always true",
+		"lint.bs:8:10: [unassigned-name] the name 'missing' is used but never given a value",
+		"lint.bs:9:7: [static-loop] nothing in this loop changes its condition",
+	}
+
+	warnings, err := LintProgram(new(Opts), "lint.bs", program)
+	if err != nil {
+		t.Fatalf("expected the program to parse, got %v", err)
+	}
+	actual := make([]string, len(warnings))
+	for i, w := range warnings {
+		actual[i] = w.String()
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected warnings\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	// every procedure has names of its own, like it does when the program runs
+	scoped := "by remember of amount we mean\n" +
+		"\tthe stored is the amount\n" +
+		"by recall of amount we mean\n" +
+		"\treturns the stored\n" +
+		"show of remember of 1\n" +
+		"show of recall of 2\n" +
+		"the length is 3\n" +
+		"the length is 4\n" +
+		"show the length\n"
+	expected = []string{
+		"scoped.bs:2:2: [unused-name] the name 'stored' is given a value but never used",
+		"scoped.bs:3:14: [unused-name] the name 'amount' is given a value but never used",
+		"scoped.bs:4:10: [unassigned-name] the name 'stored' is used but never given a value",
+		"scoped.bs:7:1: [shadowed-builtin] name 'length' hides the builtin of the same name",
+	}
+	warnings, err = LintProgram(new(Opts), "scoped.bs", scoped)
+	if err != nil {
+		t.Fatalf("expected the program to parse, got %v", err)
+	}
+	actual = make([]string, len(warnings))
+	for i, w := range warnings {
+		actual[i] = w.String()
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected warnings\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+
+	dir := t.TempDir()
+	files := []struct {
+		program string
+		rc      int
+	}{
+		{"the unused is 1\n", EXIT_LINT_WARNINGS},
+		{"the used is 1\nshow the used\n", 0},
+	}
+	for i, f := range files {
+		filePath := fmt.Sprintf("%s/%d.bs", dir, i)
+		if err := os.WriteFile(filePath, []byte(f.program), 0644); err != nil {
+			panic(err)
+		}
+		opts := new(Opts)
+		buf := new(strings.Builder)
+		opts.ostr = buf
+		opts.estr = buf
+		if rc := runLint(opts, []string{filePath}); rc != f.rc {
+			t.Errorf("expected linting '%s' to exit with %d, got %d: %s", f.program, f.rc, rc, buf.String())
+		}
+	}
+}
+
+// frames a message the way an editor would send it
+func lspFrame(id int, method string, params any) string {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method, "params": params}
+	if id > 0 {
+		msg["id"] = id
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func TestLanguageServer(t *testing.T) {
+	uri := "file:///tmp/doubling.bs"
+	program := "by double of it we mean\n" +
+		"\treturns it plus it\n" +
+		"the count  is 3\n" +
+		"show of double of the count\n"
+	broken := program + "show of 1 plus\n"
+	at := func(line int, character int) map[string]any {
+		return map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": line, "character": character},
+		}
+	}
+	document := map[string]any{"textDocument": map[string]any{"uri": uri}}
+
+	script := lspFrame(1, "initialize", map[string]any{}) +
+		lspFrame(0, "initialized", map[string]any{}) +
+		lspFrame(0, "textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": "boomslang", "version": 1, "text": program},
+		}) +
+		lspFrame(2, "textDocument/hover", at(3, 9)) +
+		lspFrame(3, "textDocument/definition", at(3, 24)) +
+		lspFrame(4, "textDocument/definition", at(1, 10)) +
+		lspFrame(5, "textDocument/documentSymbol", document) +
+		lspFrame(6, "textDocument/completion", at(3, 0)) +
+		lspFrame(7, "textDocument/formatting", document) +
+		lspFrame(8, "textDocument/hover", at(3, 1)) +
+		lspFrame(9, "textDocument/unheardOf", document) +
+		lspFrame(0, "textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []any{map[string]any{"text": broken}},
+		}) +
+		lspFrame(10, "shutdown", nil) +
+		lspFrame(0, "exit", nil)
+
+	opts := new(Opts)
+	out := new(strings.Builder)
+	opts.istr = strings.NewReader(script)
+	opts.ostr = out
+	opts.estr = out
+	if rc := runLsp(opts, nil); rc != 0 {
+		t.Errorf("expected the server to exit with 0 after shutdown, got %d", rc)
+	}
+
+	responses := make(map[string]lspMessage)
+	var diagnostics []lspDiagnostic
+	buf := bufio.NewReader(strings.NewReader(out.String()))
+	for {
+		header, err := buf.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		var length int
+		fmt.Sscanf(header, "Content-Length: %d", &length)
+		buf.ReadString('\n')
+		body := make([]byte, length)
+		io.ReadFull(buf, body)
+
+		var msg lspMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("server sent something that is not json: %s", body)
+		}
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params struct{ Diagnostics []lspDiagnostic }
+			json.Unmarshal(msg.Params, &params)
+			diagnostics = params.Diagnostics
+		} else {
+			responses[string(msg.Id)] = msg
+		}
+	}
+	result := func(id string, into any) {
+		msg, ok := responses[id]
+		if !ok {
+			t.Fatalf("no response to request %s", id)
+		}
+		if err := json.Unmarshal(msg.Result, into); err != nil {
+			t.Fatalf("bad result for request %s: %s", id, msg.Result)
+		}
+	}
+
+	var initialized struct{ Capabilities map[string]any }
+	result("1", &initialized)
+	if initialized.Capabilities["hoverProvider"] != true || initialized.Capabilities["documentFormattingProvider"] != true {
+		t.Errorf("expected hover and formatting to be offered, got %v", initialized.Capabilities)
+	}
+
+	var hover lspHover
+	result("2", &hover)
+	if !strings.Contains(hover.Contents.Value, "by double of it we mean") {
+		t.Errorf("expected hover to show the signature of double, got '%s'", hover.Contents.Value)
+	}
+	result("8", &hover)
+	if !strings.Contains(hover.Contents.Value, "builtin") {
+		t.Errorf("expected hover over show to call it a builtin, got '%s'", hover.Contents.Value)
+	}
+
+	var location lspLocation
+	result("3", &location)
+	if location.Uri != uri || location.Range.Start != (lspPosition{2, 0}) {
+		t.Errorf("expected the count to be defined at 2:0, got %v", location)
+	}
+	result("4", &location)
+	if location.Range.Start != (lspPosition{0, 13}) {
+		t.Errorf("expected the parameter to be defined at 0:13, got %v", location)
+	}
+
+	var symbols []lspSymbol
+	result("5", &symbols)
+	if len(symbols) != 2 || symbols[0].Name != "double" || symbols[1].Name != "count" {
+		t.Errorf("expected the symbols double and count, got %v", symbols)
+	} else if len(symbols[0].Children) != 1 || symbols[0].Range.End != (lspPosition{1, 19}) {
+		t.Errorf("expected double to span its body and hold its parameter, got %v", symbols[0])
+	}
+
+	var completions []lspCompletion
+	result("6", &completions)
+	labels := make(map[string]bool)
+	for _, item := range completions {
+		labels[item.Label] = true
+	}
+	for _, label := range []string{"otherwise", "show", "plus", "double", "count"} {
+		if !labels[label] {
+			t.Errorf("expected '%s' to be completed, got %v", label, completions)
+		}
+	}
+
+	var edits []lspTextEdit
+	result("7", &edits)
+	if len(edits) != 1 || !strings.Contains(edits[0].NewText, "\nthe count is 3\n") || edits[0].Range.End != (lspPosition{4, 0}) {
+		t.Errorf("expected one edit replacing the whole document, got %v", edits)
+	}
+
+	if msg := responses["9"]; msg.Error == nil || msg.Error.Code != LSP_METHOD_NOT_FOUND {
+		t.Errorf("expected an unknown method to be refused, got %v", msg)
+	}
+
+	if len(diagnostics) != 1 || diagnostics[0].Severity != LSP_SEVERITY_ERROR || diagnostics[0].Range.Start.Line != 4 {
+		t.Errorf("expected one error on line 4 after the change, got %v", diagnostics)
+	}
+}
+
+// talks to a debug adapter over pipes, one request at a time
+type dapClient struct {
+	t   *testing.T
+	w   io.Writer
+	r   *bufio.Reader
+	seq int
+}
+
+func (c *dapClient) send(command string, args any) int {
+	c.seq += 1
+	body, err := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	if err != nil {
+		panic(err)
+	}
+	writeFrame(c.w, body)
+	return c.seq
+}
+
+// reads messages until the one wanted shows up, handing back its body
+func (c *dapClient) expect(kind string, name string, into any) dapMessage {
+	for {
+		body, err := readFrame(c.r)
+		if err != nil {
+			c.t.Fatalf("adapter went away while waiting for %s %s", kind, name)
+		}
+		var msg dapMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			c.t.Fatalf("adapter sent something that is not json: %s", body)
+		}
+		if msg.Type != kind || (msg.Command != name && msg.Event != name) {
+			continue
+		}
+		if msg.Success != nil && !*msg.Success {
+			c.t.Fatalf("%s failed: %s", name, msg.Message)
+		}
+		if into != nil {
+			if err := json.Unmarshal(msg.Body, into); err != nil {
+				c.t.Fatalf("bad body for %s: %s", name, msg.Body)
+			}
+		}
+		return msg
+	}
+}
+
+func (c *dapClient) request(command string, args any, into any) {
+	c.send(command, args)
+	c.expect("response", command, into)
+}
+
+func TestDebugAdapter(t *testing.T) {
+	program := "by double of it we mean\n" +
+		"\tthe twice is the it plus the it\n" +
+		"\treturns the twice\n" +
+		"the count is 3\n" +
+		"the result is double of the count\n" +
+		"show of the result\n"
+	filePath := t.TempDir() + "/doubling.bs"
+	if err := os.WriteFile(filePath, []byte(program), 0644); err != nil {
+		panic(err)
+	}
+
+	toAdapter, fromClient := io.Pipe()
+	fromAdapter, toClient := io.Pipe()
+	opts := new(Opts)
+	opts.istr = toAdapter
+	opts.ostr = toClient
+	opts.estr = io.Discard
+	rc := make(chan int)
+	go func() {
+		rc <- runDap(opts, nil)
+		toClient.Close()
+	}()
+	c := &dapClient{t: t, w: fromClient, r: bufio.NewReader(fromAdapter)}
+
+	type frames struct {
+		StackFrames []struct {
+			Id   int
+			Name string
+			Line int
+		}
+	}
+	// where the program stopped, as procedure:line from the top
+	where := func(reason string) string {
+		var stopped struct{ Reason string }
+		c.expect("event", "stopped", &stopped)
+		if stopped.Reason != reason {
+			t.Errorf("expected to stop for %s, stopped for %s", reason, stopped.Reason)
+		}
+		var stack frames
+		c.request("stackTrace", map[string]any{"threadId": 1}, &stack)
+		parts := make([]string, len(stack.StackFrames))
+		for i, frame := range stack.StackFrames {
+			parts[i] = fmt.Sprintf("%s:%d", frame.Name, frame.Line)
+		}
+		return strings.Join(parts, " ")
+	}
+	variables := func(reference int) map[string]string {
+		var body struct {
+			Variables []struct{ Name, Value string }
+		}
+		c.request("variables", map[string]any{"variablesReference": reference}, &body)
+		values := make(map[string]string)
+		for _, v := range body.Variables {
+			values[v.Name] = v.Value
+		}
+		return values
+	}
+
+	c.request("initialize", map[string]any{"adapterID": "boomslang"}, nil)
+	c.expect("event", "initialized", nil)
+	c.request("launch", map[string]any{"program": filePath}, nil)
+	var breakpoints struct{ Breakpoints []struct{ Verified bool } }
+	c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": filePath},
+		"breakpoints": []any{map[string]any{"line": 4}, map[string]any{"line": 99}},
+	}, &breakpoints)
+	if len(breakpoints.Breakpoints) != 2 || !breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[1].Verified {
+		t.Errorf("expected only the breakpoint on a statement to be verified, got %v", breakpoints)
+	}
+	c.request("configurationDone", nil, nil)
+
+	if at := where("breakpoint"); at != "main:4" {
+		t.Errorf("expected to stop at the breakpoint, stopped at %s", at)
+	}
+	c.request("next", map[string]any{"threadId": 1}, nil)
+	if at := where("step"); at != "main:5" {
+		t.Errorf("expected next to go to the next line, went to %s", at)
+	}
+	c.request("stepIn", map[string]any{"threadId": 1}, nil)
+	if at := where("step"); at != "double:2 main:5" {
+		t.Errorf("expected to step into double, went to %s", at)
+	}
+	c.request("next", map[string]any{"threadId": 1}, nil)
+	if at := where("step"); at != "double:3 main:5" {
+		t.Errorf("expected to step over the assignment, went to %s", at)
+	}
+
+	var scopes struct {
+		Scopes []struct {
+			Name               string
+			VariablesReference int
+		}
+	}
+	c.request("scopes", map[string]any{"frameId": 2}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("expected locals and globals, got %v", scopes)
+	}
+	locals := variables(scopes.Scopes[0].VariablesReference)
+	if locals["it"] != "3" || locals["twice"] != "6" {
+		t.Errorf("expected it and twice in the locals, got %v", locals)
+	}
+	globals := variables(scopes.Scopes[1].VariablesReference)
+	if globals["count"] != "3" || globals["double"] == "" || globals["show"] != "" {
+		t.Errorf("expected the names of the program without the builtins, got %v", globals)
+	}
+
+	var evaluated struct{ Result string }
+	c.request("evaluate", map[string]any{"expression": "the it plus 1", "frameId": 2}, &evaluated)
+	if evaluated.Result != "4" {
+		t.Errorf("expected the it plus 1 to be 4, got %s", evaluated.Result)
+	}
+	c.request("evaluate", map[string]any{"expression": "count", "frameId": 2, "context": "hover"}, &evaluated)
+	if evaluated.Result != "3" {
+		t.Errorf("expected hovering over count to show 3, got %s", evaluated.Result)
+	}
+
+	c.request("stepOut", map[string]any{"threadId": 1}, nil)
+	if at := where("step"); at != "main:6" {
+		t.Errorf("expected to step out to the next line of main, went to %s", at)
+	}
+	c.request("continue", map[string]any{"threadId": 1}, nil)
+	var output struct{ Category, Output string }
+	c.expect("event", "output", &output)
+	if output.Category != "stdout" || output.Output != "6" {
+		t.Errorf("expected the program to show 6, got %v", output)
+	}
+	var exited struct{ ExitCode int }
+	c.expect("event", "exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("expected the program to exit with 0, got %d", exited.ExitCode)
+	}
+	c.expect("event", "terminated", nil)
+	c.request("disconnect", nil, nil)
+	if code := <-rc; code != 0 {
+		t.Errorf("expected the adapter to finish with 0, got %d", code)
+	}
+}
+
+func TestDebugger(t *testing.T) {
+	program := "by double of it we mean\n" +
+		"\tthe twice is the it plus the it\n" +
+		"\treturns the twice\n" +
+		"the count is 3\n" +
+		"show of double of the count\n"
+	filePath := t.TempDir() + "/doubling.bs"
+	if err := os.WriteFile(filePath, []byte(program), 0644); err != nil {
+		panic(err)
+	}
+	commands := "break 7\n" +
+		"break 2\n" +
+		"continue\n" +
+		"where\n" +
+		"print the it plus 1\n" +
+		"locals\n" +
+		"next\n" +
+		"\n"
+	expected := "stopped at %[1]s:1 (entry)\n" +
+		"   1  by double of it we mean\n" +
+		"(debug) there is no statement on line '7' to stop at\n" +
+		"(debug) breakpoint at %[1]s:2\n" +
+		"(debug) stopped at %[1]s:2 (breakpoint)\n" +
+		"   2  \tthe twice is the it plus the it\n" +
+		"(debug)   [0] : in double at %[1]s:2\n" +
+		"  [1] : in main at %[1]s:5\n" +
+		"(debug) 4\n" +
+		"(debug) the it is 3\n" +
+		"(debug) stopped at %[1]s:3 (step)\n" +
+		"   3  \treturns the twice\n" +
+		"(debug) 6\n" +
+		"the program finished with status 0\n"
+
+	opts := new(Opts)
+	out := new(strings.Builder)
+	opts.istr = strings.NewReader(commands)
+	opts.ostr = out
+	opts.estr = out
+	if rc := runDebug(opts, []string{filePath}); rc != 0 {
+		t.Errorf("expected the program to exit with 0, got %d", rc)
+	}
+	if actual := out.String(); actual != fmt.Sprintf(expected, filePath) {
+		t.Errorf("expected debugging session\n%s\ngot\n%s", fmt.Sprintf(expected, filePath), actual)
+	}
+
+	// quitting stops the program before it shows anything
+	out.Reset()
+	opts.istr = strings.NewReader("quit\n")
+	if rc := runDebug(opts, []string{filePath}); rc != 0 || !strings.HasSuffix(out.String(), DEBUG_PROMPT) {
+		t.Errorf("expected quitting to stop the program, got %d: %s", rc, out.String())
+	}
+}
+
+func TestTrace(t *testing.T) {
+	program := "by double of it we mean\n" +
+		"\treturns the it plus the it\n" +
+		"the count is 3\n" +
+		"show double the count\n"
+	tracePath := t.TempDir() + "/trace.txt"
+
+	opts := parse_opts([]string{"--trace=" + tracePath, "-e", program})
+	out := new(strings.Builder)
+	opts.ostr = out
+	opts.estr = out
+	if rc := executeSource(opts, MakeReaderSource("<inline>", strings.NewReader(opts.inline))); rc != 0 {
+		t.Fatalf("traced program exited with %d: %s", rc, out.String())
+	}
+	if out.String() != "6\n" {
+		t.Errorf("expected tracing to leave the output alone, got '%s'", out.String())
+	}
+	expected := "<inline>:1:1-23 depth=0 definition => nothing (nothing)\n" +
+		"<inline>:3:1-14 depth=0 assignment => nothing (nothing)\n" +
+		"<inline>:2:2-27 depth=1 returns => 6 (number)\n" +
+		"<inline>:4:1-21 depth=0 call => nothing (nothing)\n"
+	if actual := readFile(tracePath); actual != expected {
+		t.Errorf("expected trace\n%s\ngot\n%s", expected, actual)
+	}
+
+	// the same records, one json object per line
+	opts = parse_opts([]string{"--trace=" + tracePath, "--trace-format=json", "-e", program})
+	opts.ostr = out
+	opts.estr = out
+	executeSource(opts, MakeReaderSource("<inline>", strings.NewReader(opts.inline)))
+	lines := strings.Split(strings.TrimSpace(readFile(tracePath)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 records, got %d: %v", len(lines), lines)
+	}
+	var record traceRecord
+	if err := json.Unmarshal([]byte(lines[2]), &record); err != nil {
+		t.Fatalf("expected a json record, got '%s': %v", lines[2], err)
+	}
+	if record != (traceRecord{File: "<inline>", Line: 2, Column: 2, End: 27, Kind: "returns", Value: "6", Type: "number", Depth: 1}) {
+		t.Errorf("unexpected record %#v", record)
+	}
+}
+
+func TestPreprocessor(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.bs":    "#define FAILING broken\n#include parts.bs\nshow FAILING\n",
+		"parts.bs":   "\n\nshow text from parts\n",
+		"cycle.bs":   "#include cycle.bs\n",
+		"open.bs":    "show text before\n#if defined FLAG\nshow text flagged\n",
+		"flagged.bs": "#if defined FLAG\nshow text flagged\n#otherwise\nshow text plain\n#end\n",
+	}
+	for name, text := range files {
+		if err := os.WriteFile(dir+"/"+name, []byte(text), 0644); err != nil {
+			panic(err)
+		}
+	}
+	run := func(name string, defines ...string) (int, string) {
+		opts := new(Opts)
+		buf := new(strings.Builder)
+		opts.ostr = buf
+		opts.estr = buf
+		opts.defines = defines
+		return execute(opts, dir+"/"+name), buf.String()
+	}
+
+	// spans point at the line in the file it came from, even after includes and directives
+	tokens, err := MakeLexer(new(Opts), MakePreprocessor(new(Opts), FileSource{dir + "/main.bs", bufio.NewReader(strings.NewReader(files["main.bs"]))})).Lex()
+	if err != nil {
+		t.Fatalf("expected main.bs to lex, got %v", err)
+	}
+	var words []string
+	for _, tok := range tokens {
+		if tok.Ty == TOKEN_WORD || tok.Ty == TOKEN_TEXT {
+			words = append(words, fmt.Sprintf("%s@%s:%d", tok.Lex, strings.TrimPrefix(tok.Spn.SourceName, dir+"/"), tok.Spn.Lineno))
+		}
+	}
+	expected := "show@parts.bs:3 from parts@parts.bs:3 show@main.bs:3 broken@main.bs:3"
+	if strings.Join(words, " ") != expected {
+		t.Errorf("expected tokens %s, got %s", expected, strings.Join(words, " "))
+	}
+
+	if rc, out := run("cycle.bs"); rc != EXIT_LEX_FAILURE || !strings.Contains(out, "ends up including itself") {
+		t.Errorf("expected an include cycle to fail, got %d: %s", rc, out)
+	}
+	if rc, out := run("open.bs"); rc != EXIT_LEX_FAILURE || !strings.Contains(out, "open.bs:2") {
+		t.Errorf("expected an unclosed #if to fail on its line, got %d: %s", rc, out)
+	}
+	if _, out := run("flagged.bs"); out != "plain\n" {
+		t.Errorf("expected the #otherwise branch without the flag, got '%s'", out)
+	}
+	if _, out := run("flagged.bs", "FLAG"); out != "flagged\n" {
+		t.Errorf("expected the #if branch with the flag, got '%s'", out)
+	}
+	if opts := parse_opts([]string{"--define=FLAG", "--debug=pre", "file.bs"}); opts.defines[0] != "FLAG" || opts.debug != DBG_PRE {
+		t.Errorf("expected --define and --debug=pre to be picked up, got %#v", opts)
+	}
+}
+
+func TestModules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"first.bs":      "borrow the second from text second.bs\n",
+		"second.bs":     "borrow the first from text first.bs\n",
+		"library.bs":    "borrow the shared from text shared.bs\nshow the shared answer\n",
+		"lib/shared.bs": "the answer is 42\n",
+		"missing.bs":    "borrow the nothing from text nowhere.bs\n",
+		"pair.bs":       "the left is 1\nthe right is 2\n",
+		"borrower.bs":   "borrow the pair from text pair.bs\nshow the pair right\n",
+	}
+	if err := os.Mkdir(dir+"/lib", 0755); err != nil {
+		panic(err)
+	}
+	for name, text := range files {
+		if err := os.WriteFile(dir+"/"+name, []byte(text), 0644); err != nil {
+			panic(err)
+		}
+	}
+	run := func(name string) (int, string) {
+		opts := new(Opts)
+		buf := new(strings.Builder)
+		opts.ostr = buf
+		opts.estr = buf
+		return execute(opts, dir+"/"+name), buf.String()
+	}
+
+	cycle := fmt.Sprintf("%[1]s/first.bs -> %[1]s/second.bs -> %[1]s/first.bs", dir)
+	if rc, out := run("first.bs"); rc != EXIT_RUNTIME_FAILURE || !strings.Contains(out, "(ImportError)") || !strings.Contains(out, cycle) {
+		t.Errorf("expected borrowing in a circle to fail with %s, got %d: %s", cycle, rc, out)
+	}
+	if rc, out := run("missing.bs"); rc != EXIT_RUNTIME_FAILURE || !strings.Contains(out, "nowhere.bs") {
+		t.Errorf("expected a missing module to fail, got %d: %s", rc, out)
+	}
+	if rc, out := run("library.bs"); rc != EXIT_RUNTIME_FAILURE {
+		t.Errorf("expected shared.bs to be out of reach without BOOMSLANG_PATH, got %d: %s", rc, out)
+	}
+	t.Setenv("BOOMSLANG_PATH", dir+"/nowhere"+string(os.PathListSeparator)+dir+"/lib")
+	if rc, out := run("library.bs"); rc != 0 || out != "42\n" {
+		t.Errorf("expected shared.bs to be found through BOOMSLANG_PATH, got %d: %s", rc, out)
+	}
+
+	// borrowed names count like any other, next to the ones the module gave values to itself
+	for maxNames, fits := range map[int]bool{3: false, 4: true} {
+		opts := new(Opts)
+		buf := new(strings.Builder)
+		opts.ostr = buf
+		opts.estr = buf
+		opts.limits.maxNames = maxNames
+		rc := execute(opts, dir+"/borrower.bs")
+		if fits && (rc != 0 || buf.String() != "2\n") {
+			t.Errorf("expected 4 names to be enough, got %d: %s", rc, buf.String())
+		}
+		if !fits && (rc != EXIT_RUNTIME_FAILURE || !strings.Contains(buf.String(), "(ResourceError)")) {
+			t.Errorf("expected 3 names to be too few, got %d: %s", rc, buf.String())
+		}
+	}
+}
+
+func TestMultipleParameters(t *testing.T) {
+	program := "by between of low and high and value we mean\n" +
+		"\tif the value smallerthan the low\n" +
+		"\t\treturns false\n" +
+		"\treturns the value smallerthan the high\n" +
+		"show of between of 1 and 10 and maximum of 3 and 4\n" +
+		"show of between of 1 and 3 and 7\n"
+	opts := new(Opts)
+	out := new(strings.Builder)
+	opts.ostr = out
+	opts.estr = out
+	if rc := executeSource(opts, MakeReaderSource("<inline>", strings.NewReader(program))); rc != 0 || out.String() != "true\nfalse\n" {
+		t.Errorf("expected 'true' and 'false', got %d: %s", rc, out.String())
+	}
+
+	formatted, err := FormatProgram(new(Opts), "<inline>", program)
+	if err != nil || formatted != program {
+		t.Errorf("expected 'and' to survive formatting, got %v:\n%s", err, formatted)
+	}
+
+	// names can not have an 'and' in them, it would split them wherever they are read
+	for _, program := range []string{
+		"the salt and pepper is 2\n",
+		"the and is 2\n",
+		"by salt and pepper we mean\n\treturns 2\n",
+		"by salt and pepper of amount we mean\n\treturns the amount\n",
+	} {
+		_, err := NewInterpreter(Options{}).Eval(context.Background(), program)
+		var parseErr ParseError
+		if !errors.As(err, &parseErr) || !strings.Contains(err.Error(), "can not be part of a name") {
+			t.Errorf("expected %q not to parse, got %v", program, err)
+		}
+	}
+}
+
+func TestInterpreter(t *testing.T) {
+	out := new(strings.Builder)
+	interp := NewInterpreter(Options{Stdout: out, Args: []string{"first"}})
+	ctx := context.Background()
+
+	if err := interp.SetGlobal("order total", 120); err != nil {
+		t.Fatalf("expected to set a number, got %v", err)
+	}
+	if err := interp.SetGlobal("tags", []string{"new", "vip"}); err != nil {
+		t.Fatalf("expected to set a list, got %v", err)
+	}
+	if err := interp.SetGlobal("broken", map[string]int{}); err == nil {
+		t.Errorf("expected a map to be refused")
+	}
+	interp.RegisterBuiltin("discount", func(args []any) (any, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("need a total")
+		}
+		return args[0].(int64) / 10, nil
+	})
+
+	result, err := interp.Eval(ctx, "show first the tags\nthe saved is discount of the order total\nreturns the order total biggerthan 100")
+	if err != nil || result != true {
+		t.Errorf("expected true, got %v, %v", result, err)
+	}
+	// names stay around between programs
+	if saved, ok := interp.Global("saved"); !ok || saved != int64(12) {
+		t.Errorf("expected the saved to be 12, got %v", saved)
+	}
+	result, err = interp.Eval(ctx, "the arguments")
+	if err != nil || fmt.Sprint(result) != "[first]" {
+		t.Errorf("expected the arguments, got %v, %v", result, err)
+	}
+	if out.String() != "new\n" {
+		t.Errorf("expected 'new' to be shown, got '%s'", out.String())
+	}
+
+	var runtimeErr RuntimeError
+	if _, err := interp.Eval(ctx, "discount"); !errors.As(err, &runtimeErr) || !strings.Contains(err.Error(), "need a total") {
+		t.Errorf("expected the builtin to fail the program, got %v", err)
+	}
+	var exitErr ExitError
+	if _, err := interp.Eval(ctx, "exit of 3"); !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Errorf("expected an exit with 3, got %v", err)
+	}
+	var parseErr ParseError
+	if _, err := interp.Eval(ctx, "the is"); !errors.As(err, &parseErr) {
+		t.Errorf("expected a parse error, got %v", err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := interp.Eval(cancelled, "show text never"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled context to stop the program, got %v", err)
+	}
+}
+
+func TestWrapFunc(t *testing.T) {
+	interp := NewInterpreter(Options{})
+	ctx := context.Background()
+	register := func(name string, fn any) {
+		if err := interp.RegisterFunc(name, fn); err != nil {
+			t.Fatalf("expected %s to be wrapped, got %v", name, err)
+		}
+	}
+	register("repeat", func(n int64, s string) (string, error) {
+		if n < 0 {
+			return "", fmt.Errorf("can not repeat %d times", n)
+		}
+		return strings.Repeat(s, int(n)), nil
+	})
+	register("total", func(numbers ...int) int {
+		sum := 0
+		for _, n := range numbers {
+			sum += n
+		}
+		return sum
+	})
+	register("words", func(list []string) int { return len(list) })
+	register("shout", func(env *BsEnv, value any) { fmt.Fprintf(env.ostr, "%v!\n", value) })
+	register("small", func(n int8) int8 { return n })
+	register("crash", func(list []string) string { return list[3] })
+
+	cases := []struct {
+		program  string
+		expected any
+		failure  string
+	}{
+		{"repeat of 3 and text ab", "ababab", ""},
+		{"total of 1 and 2 and 3", int64(6), ""},
+		{"total", int64(0), ""},
+		{"words of the arguments", int64(0), ""},
+		{"shout of 3", nil, ""},
+		{"repeat of text ab", nil, "(MethodError)"},
+		{"repeat of 2 and 3", nil, "(TypeError) Sorry, but this is not a valid text: 3"},
+		{"repeat of 0 minus 1 and text ab", nil, "(HostError) Sorry, but 'repeat' could not do what you asked: can not repeat -1 times"},
+		{"total of 1 and text two", nil, "not a valid number: two"},
+		{"small of 300", nil, "not a valid number for a int8: 300"},
+		{"crash of the arguments", nil, "(HostError) Sorry, but 'crash' could not do what you asked: it panicked: runtime error: index out of range"},
+	}
+	for _, c := range cases {
+		result, err := interp.Eval(ctx, c.program)
+		if c.failure == "" && (err != nil || result != c.expected) {
+			t.Errorf("expected '%s' to give %v, got %v, %v", c.program, c.expected, result, err)
+		}
+		if c.failure != "" && (err == nil || !strings.Contains(err.Error(), c.failure)) {
+			t.Errorf("expected '%s' to fail with %s, got %v", c.program, c.failure, err)
+		}
+	}
+
+	for _, fn := range []any{42, func(m map[string]int) {}, func() (error, int) { return nil, 0 }, func() (int, int) { return 0, 0 }} {
+		if _, err := WrapFunc("bad", fn); err == nil {
+			t.Errorf("expected %T to be refused", fn)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	forever := "while true\n\tthe count is 1\n"
+	ctx := context.Background()
+
+	interp := NewInterpreter(Options{MaxSteps: 1000})
+	if _, err := interp.Eval(ctx, forever); err == nil || !strings.Contains(err.Error(), "(TimeoutError)") || !strings.Contains(err.Error(), "1000 steps") {
+		t.Errorf("expected the step budget to stop the loop, got %v", err)
+	}
+	// every Eval gets the whole budget again
+	if result, err := interp.Eval(ctx, "returns 1 plus 1"); err != nil || result != int64(2) {
+		t.Errorf("expected a fresh budget for the next program, got %v, %v", result, err)
+	}
+
+	interp = NewInterpreter(Options{Timeout: 20 * time.Millisecond})
+	if _, err := interp.Eval(ctx, forever); !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "ran out of time") {
+		t.Errorf("expected the timeout to stop the loop, got %v", err)
+	}
+
+	// recursion is stopped at its calls, and cancelling works from anywhere
+	interp = NewInterpreter(Options{})
+	cancellable, cancel := context.WithCancel(ctx)
+	interp.RegisterFunc("stop", func() { cancel() })
+	if _, err := interp.Eval(cancellable, "by again we mean\n\tstop\n\tagain\nagain\n"); !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "was cancelled") {
+		t.Errorf("expected cancelling to stop the recursion, got %v", err)
+	}
+
+	opts := parse_opts([]string{"--max-steps=50", "--timeout=2s", "-e", forever})
+	if opts.limits.maxSteps != 50 || opts.limits.timeout != 2*time.Second {
+		t.Fatalf("expected --max-steps and --timeout to be picked up, got %#v", opts)
+	}
+	out := new(strings.Builder)
+	opts.ostr = out
+	opts.estr = out
+	if rc := executeSource(opts, MakeReaderSource("<inline>", strings.NewReader(opts.inline))); rc != EXIT_RUNTIME_FAILURE || !strings.Contains(out.String(), "50 steps") {
+		t.Errorf("expected the program to be stopped after 50 steps, got %d: %s", rc, out.String())
+	}
+}
+
+func TestRecursionLimit(t *testing.T) {
+	program := "by ping of it we mean\n" +
+		"\treturns pong of the it plus 1\n" +
+		"by pong of it we mean\n" +
+		"\treturns ping of the it plus 1\n" +
+		"ping of 0\n"
+	ctx := context.Background()
+
+	interp := NewInterpreter(Options{MaxDepth: 20})
+	failure := evalFailure(t, interp, program)
+	recursion, ok := failure.(BsRecursionErr)
+	if !ok {
+		t.Fatalf("expected a (RecursionError), got %s", failure.PrettyPrint())
+	}
+	expected := []string{"pong, defined at <eval>:3", "ping, defined at <eval>:1", "pong, defined at <eval>:3", "ping, defined at <eval>:1", "pong, defined at <eval>:3"}
+	if recursion.depth != 20 || strings.Join(recursion.frames, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected the innermost calls %v, got %d deep %v", expected, recursion.depth, recursion.frames)
+	}
+	// deep enough, but not too deep
+	if result, err := interp.Eval(ctx, "by down of it we mean\n\tif the it equals 0\n\t\treturns 0\n\treturns down of the it minus 1\nreturns down of 19\n"); err != nil || result != int64(0) {
+		t.Errorf("expected 20 calls to be fine, got %v, %v", result, err)
+	}
+
+	// without a limit of its own, a program still fails long before Go runs out of stack
+	if _, err := NewInterpreter(Options{}).Eval(ctx, program); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("more than %d deep", DEFAULT_MAX_DEPTH)) {
+		t.Errorf("expected the default limit to stop the recursion, got %v", err)
+	}
+
+	if opts := parse_opts([]string{"--max-depth=7", "file.bs"}); opts.limits.maxDepth != 7 {
+		t.Errorf("expected --max-depth to be picked up, got %#v", opts)
+	}
+}
+
+func TestResourceLimits(t *testing.T) {
+	ctx := context.Background()
+
+	interp := NewInterpreter(Options{MaxTextLength: 10, MaxListLength: 3, MaxNames: 5})
+	interp.RegisterFunc("repeat", func(n int64, s string) string { return strings.Repeat(s, int(n)) })
+	interp.RegisterFunc("numbers", func(n int64) []int64 { return make([]int64, n) })
+	if result, err := interp.Eval(ctx, "returns repeat of 5 and text ab\n"); err != nil || result != "ababababab" {
+		t.Errorf("expected 10 letters to be fine, got %v, %v", result, err)
+	}
+	for _, program := range []string{"repeat of 6 and text ab\n", "numbers of 4\n"} {
+		if failure, ok := evalFailure(t, interp, program).(BsResourceErr); !ok {
+			t.Errorf("expected a (ResourceError) for %q, got %s", program, failure.PrettyPrint())
+		}
+	}
+
+	// builtins find out before they make something too big
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := os.WriteFile(dir+"/"+name, []byte("0123456789+"), 0644); err != nil {
+			panic(err)
+		}
+	}
+	builtins := NewInterpreter(Options{MaxTextLength: 10, MaxListLength: 3})
+	for _, program := range []string{
+		"the half is text abcdef\nreturns together of the half and the half\n",
+		"characters of text abcd\n",
+		"contents of text " + dir + "/a\n",
+		"lines of text " + dir + "/a\n",
+		"files of text " + dir + "\n",
+	} {
+		if failure, ok := evalFailure(t, builtins, program).(BsResourceErr); !ok {
+			t.Errorf("expected a (ResourceError) for %q, got %s", program, failure.PrettyPrint())
+		}
+	}
+
+	// names that go away with their procedure do not count
+	if _, err := interp.Eval(ctx, "by f of it we mean\n\treturns the it\nthe a is f of 1\nthe b is f of 2\nthe c is f of 3\n"); err != nil {
+		t.Errorf("expected 4 names to be fine, got %v", err)
+	}
+	if _, err := interp.Eval(ctx, "the d is 4\nthe e is 5\n"); err == nil || !strings.Contains(err.Error(), "5 names") {
+		t.Errorf("expected the sixth name to fail, got %v", err)
+	}
+	if _, err := interp.Eval(ctx, "the a is 10\n"); err != nil {
+		t.Errorf("expected giving an old name a new value to be fine, got %v", err)
+	}
+
+	// the sandbox picks limits and leaves out what reaches outside the program
+	sandboxed := NewInterpreter(Options{Sandbox: true, MaxNames: 2})
+	if _, err := sandboxed.Eval(ctx, "ask\n"); err == nil || !strings.Contains(err.Error(), "'ask' was withheld by policy") {
+		t.Errorf("expected ask to be missing in the sandbox, got %v", err)
+	}
+	if _, err := sandboxed.Eval(ctx, "the a is 1\nthe b is 2\nthe c is 3\n"); err == nil || !strings.Contains(err.Error(), "(ResourceError)") {
+		t.Errorf("expected MaxNames to win over the sandbox default, got %v", err)
+	}
+	if _, err := sandboxed.Eval(ctx, "while true\n\tthe a is 1\n"); err == nil || !strings.Contains(err.Error(), "(TimeoutError)") {
+		t.Errorf("expected the sandbox to stop a program that never ends, got %v", err)
+	}
+
+	opts := parse_opts([]string{"--sandbox", "--max-text=4", "--max-items=5", "--max-names=6", "file.bs"})
+	if !opts.sandbox || opts.limits.maxText != 4 || opts.limits.maxItems != 5 || opts.limits.maxNames != 6 {
+		t.Errorf("expected --sandbox and the memory limits to be picked up, got %#v", opts)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	ctx := context.Background()
+
+	output, files, nothing := CAP_CONSOLE_OUTPUT, CAP_FILESYSTEM, Capability(0)
+	interp := NewInterpreter(Options{Allow: &output, Stdin: strings.NewReader("hi\n")})
+	for _, program := range []string{"ask\n", "environment of text HOME\n"} {
+		failure := evalFailure(t, interp, program)
+		if nameErr, ok := failure.(BsNameErr); !ok || nameErr.withheld == 0 || !strings.Contains(failure.PrettyPrint(), "withheld by policy") {
+			t.Errorf("expected %q to be withheld by policy, got %s", program, failure.PrettyPrint())
+		}
+	}
+	if _, err := interp.Eval(ctx, "show of 1\n"); err != nil {
+		t.Errorf("expected show to be allowed, got %v", err)
+	}
+	// a program can still have names of its own that builtins were withheld under
+	if result, err := interp.Eval(ctx, "by ask we mean\n\treturns 3\nreturns ask\n"); err != nil || result != int64(3) {
+		t.Errorf("expected the program's own ask, got %v, %v", result, err)
+	}
+	// borrowing and including read files, so they need the file system just like contents does
+	module := t.TempDir() + "/shared.bs"
+	if err := os.WriteFile(module, []byte("the answer is 42\n"), 0644); err != nil {
+		panic(err)
+	}
+	reading := []string{
+		"borrow the shared from text " + module + "\nreturns the shared answer\n",
+		"#include " + module + "\nreturns the answer\n",
+	}
+	for _, program := range reading {
+		if _, err := interp.Eval(ctx, program); err == nil || !strings.Contains(err.Error(), "was withheld by policy, this program is not allowed to use the file system") {
+			t.Errorf("expected %q to be withheld by policy, got %v", program, err)
+		}
+	}
+	for _, program := range reading {
+		allowed := NewInterpreter(Options{Allow: &files})
+		if result, err := allowed.Eval(ctx, program); err != nil || result != int64(42) {
+			t.Errorf("expected %q to work with the file system allowed, got %v, %v", program, result, err)
+		}
+	}
+
+	// names nobody ever had stay plain name errors
+	if _, err := interp.Eval(ctx, "unheard of\n"); err == nil || strings.Contains(err.Error(), "withheld") {
+		t.Errorf("expected an ordinary name error, got %v", err)
+	}
+
+	if _, err := NewInterpreter(Options{Stdin: strings.NewReader("hi\n")}).Eval(ctx, "ask\n"); err != nil {
+		t.Errorf("expected everything to be allowed by default, got %v", err)
+	}
+	if _, err := NewInterpreter(Options{Allow: &nothing}).Eval(ctx, "show of 1\n"); err == nil || !strings.Contains(err.Error(), "withheld by policy") {
+		t.Errorf("expected allowing nothing to withhold show as well, got %v", err)
+	}
+
+	opts := parse_opts([]string{"--allow=input,clock", "file.bs"})
+	if opts.withheld() != CAP_ALL&^(CAP_CONSOLE_INPUT|CAP_CLOCK) {
+		t.Errorf("expected --allow to withhold everything else, got %s", opts.withheld())
+	}
+	if opts := parse_opts([]string{"--sandbox", "--allow=all", "file.bs"}); opts.withheld() != 0 {
+		t.Errorf("expected --allow to win over --sandbox, got %s", opts.withheld())
+	}
+	if _, err := parseCapabilities("telepathy"); err == nil {
+		t.Errorf("expected an unknown capability to be refused")
+	}
+}
+
+func TestFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "app.log")
+
+	interp := NewInterpreter(Options{Args: []string{"a", "b"}})
+	interp.SetGlobal("log", log)
+	interp.SetGlobal("folder", dir)
+	interp.SetGlobal("copy", filepath.Join(dir, "copy.log"))
+	cases := []evalCase{
+		{"returns exists of the log\n", false},
+		{"write of the log and text first line\n", nil},
+		{"returns contents of the log\n", "first line"},
+		{"append of the log and text second line\n", nil},
+		{"returns contents of the log\n", "first line\nsecond line\n"},
+		{"append of the log and text third line\n", nil},
+		{"returns lines of the log\n", []any{"first line", "second line", "third line"}},
+		{"returns exists of the log\n", true},
+		{"returns files of the folder\n", []any{"app.log"}},
+		{"write of the log and text replaced\n", nil},
+		{"returns lines of the log\n", []any{"replaced"}},
+		{"write of the copy and the arguments\nreturns lines of the copy\n", []any{"a", "b"}},
+		{"remove of the copy\n", nil},
+		{"remove of the log\n", nil},
+		{"returns files of the folder\n", []any{}},
+	}
+	evalCases(t, interp, cases)
+
+	for _, program := range []string{"contents of the log\n", "remove of the log\n", "files of the log\n"} {
+		if failure, ok := evalFailure(t, interp, program).(BsIoErr); !ok {
+			t.Errorf("expected an (IoError) for %q, got %s", program, failure.PrettyPrint())
+		}
+	}
+
+	if _, err := NewInterpreter(Options{Sandbox: true}).Eval(ctx, "write of text x and text y\n"); err == nil || !strings.Contains(err.Error(), "not allowed to use the file system") {
+		t.Errorf("expected the file system to be withheld in the sandbox, got %v", err)
+	}
+}
+
+func TestAsk(t *testing.T) {
+	ctx := context.Background()
+	out := new(strings.Builder)
+	input := "Ada Lovelace\n" +
+		"Grace\n" +
+		"\n" +
+		"twelve\n" +
+		"12\n" +
+		"\n" +
+		"7"
+	interp := NewInterpreter(Options{Stdin: strings.NewReader(input), Stdout: out})
+	cases := []evalCase{
+		// whole lines, and the rest of the line does not leak into the next ask
+		{"returns ask text Your name?\n", "Ada Lovelace"},
+		{"returns ask\n", "Grace"},
+		{"the usual is text Bob\nreturns ask of the usual and text Your name?\n", "Bob"},
+		{"returns ask for a number text Your age?\n", int64(12)},
+		{"returns ask for a number of 3 and text How many?\n", int64(3)},
+		// the last line does not need a line ending
+		{"returns ask for a number\n", int64(7)},
+		{"returns ask text Anything else?\n", nil},
+		{"returns ask for a number\n", nil},
+	}
+	evalCases(t, interp, cases)
+	expected := "Your name? " +
+		"Your name? [Bob] " +
+		"Your age? Sorry, but 'twelve' is not a number, please try again.\n" +
+		"Your age? " +
+		"How many? [3] " +
+		"Anything else? "
+	if out.String() != expected {
+		t.Errorf("expected the prompts %q, got %q", expected, out.String())
+	}
+
+	if _, err := interp.Eval(ctx, "ask for a number of the usual and text Count?\n"); err == nil || !strings.Contains(err.Error(), "not a valid number") {
+		t.Errorf("expected a default that is not a number to fail, got %v", err)
+	}
+
+	formatted, err := FormatProgram(new(Opts), "<ask>", "the age is  ask for a number  text Your age?\n")
+	if err != nil || formatted != "the age is ask for a number text Your age?\n" {
+		t.Errorf("expected ask for a number to be formatted as it is, got %q, %v", formatted, err)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	ctx := context.Background()
+	program := "the rolls is 0\n" +
+		"the count is 0\n" +
+		"while the count smallerthan 15\n" +
+		"\tthe count is the count plus 1\n" +
+		"\tthe roll is random of 1 and 9\n" +
+		"\tthe rolls is the roll plus the rolls multiply 10\n" +
+		"returns the rolls\n"
+	roll := func(seed int64) any {
+		result, err := NewInterpreter(Options{Seed: &seed}).Eval(ctx, program)
+		if err != nil {
+			t.Fatalf("rolling failed: %v", err)
+		}
+		return result
+	}
+	if roll(42) != roll(42) {
+		t.Errorf("expected the same seed to roll the same numbers")
+	}
+	if roll(42) == roll(43) {
+		t.Errorf("expected another seed to roll other numbers")
+	}
+	if roll(0) != roll(0) {
+		t.Errorf("expected 0 to be a seed like any other")
+	}
+
+	seed := int64(1)
+	interp := NewInterpreter(Options{Seed: &seed, Args: []string{"a", "b", "c", "d"}})
+	picked, err := interp.Eval(ctx, "returns pick of the arguments\n")
+	if err != nil || !slices.Contains([]any{"a", "b", "c", "d"}, picked) {
+		t.Errorf("expected one of the arguments to be picked, got %v, %v", picked, err)
+	}
+	shuffled, err := interp.Eval(ctx, "returns shuffle of the arguments\n")
+	sorted := slices.Clone(shuffled.([]any))
+	slices.SortFunc(sorted, func(a, b any) int { return strings.Compare(a.(string), b.(string)) })
+	if err != nil || !reflect.DeepEqual(sorted, []any{"a", "b", "c", "d"}) {
+		t.Errorf("expected the arguments in some order, got %v, %v", shuffled, err)
+	}
+	if args, _ := interp.Eval(ctx, "returns the arguments\n"); !reflect.DeepEqual(args, []any{"a", "b", "c", "d"}) {
+		t.Errorf("expected shuffle to leave the list as it was, got %v", args)
+	}
+
+	// ranges as wide as numbers go
+	for _, program := range []string{
+		"random of 0 and 9223372036854775807\n",
+		"random of 0 minus 9223372036854775807 and 9223372036854775807\n",
+	} {
+		if _, err := interp.Eval(ctx, program); err != nil {
+			t.Errorf("expected %q to give a number, got %v", program, err)
+		}
+	}
+	if result, err := interp.Eval(ctx, "random of 9223372036854775807 and 9223372036854775807\n"); err != nil || result != int64(math.MaxInt64) {
+		t.Errorf("expected the only number there is, got %v, %v", result, err)
+	}
+
+	for _, program := range []string{"random of 6 and 1\n", "pick of shuffle of length of the arguments\n"} {
+		if _, err := interp.Eval(ctx, program); err == nil {
+			t.Errorf("expected %q to fail", program)
+		}
+	}
+	if _, err := NewInterpreter(Options{}).Eval(ctx, "pick of the arguments\n"); err == nil || !strings.Contains(err.Error(), "something in it") {
+		t.Errorf("expected picking from nothing to fail, got %v", err)
+	}
+
+	if opts := parse_opts([]string{"--seed=-5", "file.bs"}); !opts.hasSeed || opts.seed != -5 {
+		t.Errorf("expected --seed to be picked up, got %#v", opts)
+	}
+}
+
+// a clock that only moves when a program waits
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.slept = append(c.slept, d)
+	c.now = c.now.Add(d)
+	return ctx.Err()
+}
+
+func TestClock(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2026, time.October, 19, 14, 3, 5, 0, time.UTC)}
+	interp := NewInterpreter(Options{Clock: clock})
+	interp.SetGlobal("long", "weekday, day month year at hour:minute:second")
+	interp.SetGlobal("short", "day month year")
+
+	cases := []evalCase{
+		{"returns now\n", clock.now.Unix()},
+		{"returns format of now and text hour:minute\n", "14:03"},
+		{"returns format of now and the long\n", "Monday, 19 October 2026 at 14:03:05"},
+		{"returns 3 days\n", int64(3 * 24 * 60 * 60)},
+		{"returns 2 hours plus 90 seconds\n", int64(2*60*60 + 90)},
+		{"returns duration of 1 weeks plus 1 hours plus 61 seconds\n", "7 days 1 hour 1 minute 1 second"},
+		{"returns duration of 0\n", "0 seconds"},
+		{"the start is now\nwait for 3 seconds\nwait of 2 minutes\nreturns now minus the start\n", int64(123)},
+		{"the day is timestamp of the short and text 31 December 2026\nreturns format of the day plus 1 days and the short\n", "1 January 2027"},
+	}
+	evalCases(t, interp, cases)
+	if !reflect.DeepEqual(clock.slept, []time.Duration{3 * time.Second, 2 * time.Minute}) {
+		t.Errorf("expected the program to wait 3 seconds and 2 minutes, got %v", clock.slept)
+	}
+
+	if _, err := interp.Eval(ctx, "timestamp of the short and text yesterday\n"); err == nil || !strings.Contains(err.Error(), "'yesterday' is not written like 'day month year'") {
+		t.Errorf("expected a text that is no date to fail, got %v", err)
+	}
+	if _, err := interp.Eval(ctx, "wait for text a while\n"); err == nil || !strings.Contains(err.Error(), "(TypeError)") {
+		t.Errorf("expected waiting for text to fail, got %v", err)
+	}
+	for _, program := range []string{"the pause is 0 minus 3 seconds\nwait for the pause\n", "wait for 9223372037 seconds\n", "the pause is 200 weeks multiply 1000\nwait for the pause\n"} {
+		if failure, ok := evalFailure(t, interp, program).(BsTypeErr); !ok || !strings.Contains(failure.PrettyPrint(), "number of seconds to wait") {
+			t.Errorf("expected %q to be refused, got %s", program, failure.PrettyPrint())
+		}
+	}
+	for _, program := range []string{"returns 9223372036854775807 weeks\n", "returns 0 minus 9223372036854775807 days\n"} {
+		if failure, ok := evalFailure(t, interp, program).(BsHostErr); !ok || !strings.Contains(failure.PrettyPrint(), "more seconds than a number can hold") {
+			t.Errorf("expected %q to overflow, got %s", program, failure.PrettyPrint())
+		}
+	}
+	if len(clock.slept) != 2 {
+		t.Errorf("expected the refused waits not to wait at all, got %v", clock.slept)
+	}
+
+	// the system clock stops waiting when the program has to stop
+	started := time.Now()
+	if _, err := NewInterpreter(Options{Timeout: 20 * time.Millisecond}).Eval(ctx, "wait for 1 minutes\n"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the timeout to stop the wait, got %v", err)
+	}
+	if time.Since(started) > 5*time.Second {
+		t.Errorf("expected the wait to be cut short, it took %s", time.Since(started))
+	}
+
+	if _, err := NewInterpreter(Options{Sandbox: true}).Eval(ctx, "now\n"); err == nil || !strings.Contains(err.Error(), "not allowed to use the clock") {
+		t.Errorf("expected the clock to be withheld in the sandbox, got %v", err)
+	}
+
+	formatted, err := FormatProgram(new(Opts), "<clock>", "wait  for 3   seconds\nthe later is now plus  2 days\n")
+	if err != nil || formatted != "wait for 3 seconds\nthe later is now plus 2 days\n" {
+		t.Errorf("expected quantities to be formatted as they are, got %q, %v", formatted, err)
+	}
+}
+
+func TestReplBlocks(t *testing.T) {
+	opts := new(Opts)
+	opts.istr = strings.NewReader("show text one\n" +
+		"if 1 smallerthan 2\n" +
+		"\tshow text two\n" +
+		"\tshow text three\n" +
+		"\n" +
+		"show text four\n")
+	prompts := new(strings.Builder)
+	opts.ostr = prompts
+	source := makeReplSource(opts)
+
+	expected := []string{
+		"show text one\n",
+		"if 1 smallerthan 2\n\tshow text two\n\tshow text three\n",
+		"show text four\n",
+	}
+	for _, statement := range expected {
+		actual, err := readStatement(opts, source)
+		if err != nil {
+			t.Fatalf("expected to read %q, got error %v", statement, err)
+		}
+		if actual != statement {
+			t.Errorf("expected statement %q, got %q", statement, actual)
+		}
+	}
+	if prompts.String() != "> > ... ... ... > " {
+		t.Errorf("expected a continuation prompt for each line of the block, got %q", prompts.String())
+	}
+}
+
+func TestFormatComments(t *testing.T) {
+	program := "# counts to three\n" +
+		"the count is 0   # start here\n" +
+		"while the count smallerthan 3\n" +
+		"    # one more\n" +
+		"    the count is the count plus 1\n"
+	expected := "# counts to three\n" +
+		"the count is 0 # start here\n" +
+		"while the count smallerthan 3\n" +
+		"\t# one more\n" +
+		"\tthe count is the count plus 1\n"
+
+	actual, err := FormatProgram(new(Opts), "comments.bs", program)
+	if err != nil {
+		t.Fatalf("expected the program to format, got %v", err)
+	}
+	if actual != expected {
+		t.Errorf("expected comments to stay where they were, '%s', got '%s'", expected, actual)
+	}
+}
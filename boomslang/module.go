@@ -0,0 +1,136 @@
+package boomslang
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Modules: 'borrow the helpers from text helpers.bs' runs another file once,
+// in a global scope of its own, and hands its names over as 'the helpers NAME'.
+// Files are looked up next to the file doing the borrowing, then in BOOMSLANG_PATH
+
+type module struct {
+	env     *BsEnv
+	loading bool // still running its top level, borrowing it now would go around in circles
+}
+
+type moduleLoader struct {
+	opts    *Opts
+	modules map[string]*module // by absolute path
+	chain   []string           // the modules being loaded right now, outermost first
+}
+
+func makeModuleLoader(opts *Opts) *moduleLoader {
+	return &moduleLoader{opts: opts, modules: make(map[string]*module)}
+}
+
+func (node AstBorrow) Eval(env *BsEnv) BsValue {
+	if env.debug {
+		log.Printf(" Eval AstBorrow\n")
+	}
+	pathVal := node.path.Eval(env)
+	if pathVal.ShouldUnwind() {
+		return env.addFrame(pathVal, node, "while evaluating the file to borrow from")
+	}
+	path, ok := pathVal.(BsStrVal)
+	if !ok {
+		return BsTypeErr{expected: "file to borrow from", value: pathVal}
+	}
+
+	mod, err := env.program.modules.load(env, path.value, node.spn.SourceName)
+	if err != nil {
+		return env.addFrame(err, node, "while borrowing the %s", node.name.name)
+	}
+	for _, name := range programNames(mod.env) {
+		if name == "arguments" {
+			continue // those are ours already
+		}
+		if failure := env.bind(node.name.name+" "+name, mod.env.symbols[name]); failure != nil {
+			return env.addFrame(failure, node, "while borrowing the %s", node.name.name)
+		}
+	}
+	return BsNilVal{}
+}
+
+// runs the module the first time it is borrowed, afterwards it comes from the cache
+func (m *moduleLoader) load(env *BsEnv, path string, from string) (*module, BsValue) {
+	// modules are files, looking for them is already using the file system
+	if env.program.withheld&CAP_FILESYSTEM != 0 {
+		return nil, BsImportErr{path: path, msg: withheldByPolicy("borrowing", CAP_FILESYSTEM)}
+	}
+	if len(m.chain) == 0 {
+		// the program itself is never done loading, borrowing from it is a circle too
+		if root, err := filepath.Abs(from); err == nil && isFile(root) {
+			m.modules[root] = &module{env: env, loading: true}
+			m.chain = []string{root}
+		}
+	}
+	resolved, found := resolveModule(path, from)
+	if !found {
+		return nil, BsImportErr{path: path, msg: "there is no such file next to '" + from + "' or in BOOMSLANG_PATH"}
+	}
+	if mod, ok := m.modules[resolved]; ok {
+		if mod.loading {
+			chain := append(m.chain, resolved)
+			return nil, BsImportErr{path: path, msg: "it ends up borrowing from itself, " + strings.Join(chain, " -> ")}
+		}
+		return mod, nil
+	}
+
+	text, err := os.ReadFile(resolved)
+	if err != nil {
+		return nil, BsImportErr{path: path, msg: err.Error()}
+	}
+	ast, err := parseSource(m.opts, FileSource{resolved, bufio.NewReader(strings.NewReader(string(text)))})
+	if err != nil {
+		return nil, BsImportErr{path: path, msg: strings.TrimRight(err.Error(), "\n")}
+	}
+
+	modEnv := makeScope(m.opts, env.program)
+	LoadBuiltins(modEnv)
+	LoadArguments(modEnv, m.opts.args)
+
+	mod := &module{env: modEnv, loading: true}
+	m.modules[resolved] = mod
+	m.chain = append(m.chain, resolved)
+	out := EvalAll(modEnv, ast)
+	m.chain = m.chain[:len(m.chain)-1]
+	mod.loading = false
+	if out.ShouldUnwind() {
+		// a module that failed half way should not look like it worked the next time
+		delete(m.modules, resolved)
+		return nil, modEnv.addFrame(out, AstIdent{name: resolved}, "while running '%s'", resolved)
+	}
+	return mod, nil
+}
+
+// relative paths are tried next to the borrowing file first, then in each BOOMSLANG_PATH directory
+func resolveModule(path string, from string) (string, bool) {
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		candidates = []string{filepath.Join(filepath.Dir(from), path)}
+		for _, dir := range filepath.SplitList(os.Getenv("BOOMSLANG_PATH")) {
+			if dir != "" {
+				candidates = append(candidates, filepath.Join(dir, path))
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if isFile(candidate) {
+			abs, err := filepath.Abs(candidate)
+			if err != nil {
+				return "", false
+			}
+			return abs, true
+		}
+	}
+	return "", false
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
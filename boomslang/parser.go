@@ -1,4 +1,4 @@
-package main
+package boomslang
 
 import (
 	"bufio"
@@ -110,7 +110,8 @@ func (p *Parser) parseStmnt(words []Token) (Ast, error) {
 		if p.debug {
 			log.Printf(" return AstLiteral\n")
 		}
-		return AstLiteral{value: BsNilVal{}}, nil
+		// a blank line, it gets the span of the newline that ended it
+		return AstLiteral{value: BsNilVal{}, spn: p.previousSpan()}, nil
 	}
 
 	if words[0].Ty == TOKEN_KW_IF {
@@ -121,10 +122,10 @@ func (p *Parser) parseStmnt(words []Token) (Ast, error) {
 		if len(words) != 1 {
 			return nil, parseErr("no tokens after break", words[1])
 		}
-		node := AstBreak{returns: nil}
+		node := AstBreak{returns: nil, spn: spanOf(words)}
 		return node, nil
 	} else if words[0].Ty == TOKEN_KW_RETURNS {
-		var expr Ast = AstLiteral{value: BsNilVal{}}
+		var expr Ast = AstLiteral{value: BsNilVal{}, spn: words[0].Spn}
 		if len(words) > 1 {
 			expr1, err := p.parseExpr(words[1:])
 			if err != nil {
@@ -132,10 +133,12 @@ func (p *Parser) parseStmnt(words []Token) (Ast, error) {
 			}
 			expr = expr1
 		}
-		node := AstReturns{expr: expr}
+		node := AstReturns{expr: expr, spn: spanOf(words)}
 		return node, nil
 	} else if words[0].Ty == TOKEN_KW_BY {
 		return p.parseFuncDef(words)
+	} else if words[0].Ty == TOKEN_KW_BORROW {
+		return p.parseBorrow(words)
 	}
 
 	if left, right, found := Partition(words, TOKEN_KW_IS); found {
@@ -147,7 +150,7 @@ func (p *Parser) parseStmnt(words []Token) (Ast, error) {
 		if err != nil {
 			return nil, err
 		}
-		node := AstAssign{lval, rval}
+		node := AstAssign{lval, rval, spanOf(words)}
 		return node, nil
 	}
 
@@ -160,12 +163,8 @@ func (p *Parser) parseFuncDef(words []Token) (Ast, error) {
 	}
 	// assume first token is "BY"
 	//  BY name... OF params ... WE MEAN
-	nameTokens, remaining, found := Partition(words[1:], TOKEN_KW_OF)
-	if !found {
-		// todo
-		return nil, parseErr("expected keyword 'of' inside definition", words[0])
-	}
-	paramTokens, remaining, found := Partition(remaining, TOKEN_KW_WE_MEAN)
+	//  BY name... WE MEAN  (when there are no params)
+	head, remaining, found := Partition(words[1:], TOKEN_KW_WE_MEAN)
 	if !found {
 		// todo
 		return nil, parseErr("expected keyword 'we mean' inside definition", words[0])
@@ -173,21 +172,37 @@ func (p *Parser) parseFuncDef(words []Token) (Ast, error) {
 	if len(remaining) > 0 {
 		return nil, parseErr("unexpected tokens after 'we mean'", remaining[0])
 	}
+	nameTokens, paramTokens, hasParams := Partition(head, TOKEN_KW_OF)
+	if !hasParams {
+		nameTokens = head
+	}
 	name, err := JoinTokens(nameTokens)
 	if err != nil {
 		return nil, err
 	}
-	funcName := AstIdent{name: name}
+	funcName := AstIdent{name: name, spn: spanOf(nameTokens)}
 
-	// todo: multiplw parameters are weird
-	paramName, err := JoinTokens(paramTokens)
-	if err != nil {
-		return nil, err
-	}
-	param := AstIdent{name: paramName}
+	params := []AstIdent{}
+	if hasParams {
+		// several parameters are separated by 'and'
+		for _, tokens := range SplitByAnd(paramTokens) {
+			if len(tokens) == 0 {
+				return nil, parseErr("expected a parameter name on both sides of 'and'", words[0])
+			}
+			paramName, err := JoinTokens(tokens)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, AstIdent{name: paramName, spn: spanOf(tokens)})
+		}
 
-	if p.debug {
-		log.Printf("AstFuncDef: paramTokens = %#v, paramName = %#v\n", paramTokens, paramName)
+		if p.debug {
+			log.Printf("AstFuncDef: paramTokens = %#v, params = %#v\n", paramTokens, params)
+		}
+	}
+	// without a body the definition would quietly mean nothing
+	if p.peek().Ty != TOKEN_BEGIN_INDENT {
+		return nil, parseErr("expected the body of the definition on the indented lines after 'we mean'", words[0])
 	}
 	body, err := p.parseBlock()
 	if err != nil {
@@ -196,8 +211,30 @@ func (p *Parser) parseFuncDef(words []Token) (Ast, error) {
 
 	node := AstFuncDef{
 		name:   funcName,
-		params: []AstIdent{param},
-		body:   body}
+		params: params,
+		body:   body,
+		spn:    spanOf(words)}
+	return node, nil
+}
+
+// borrow the helpers from text helpers.bs
+func (p *Parser) parseBorrow(words []Token) (Ast, error) {
+	if p.debug {
+		log.Printf("parseBorrow %#v\n", words)
+	}
+	left, right, found := PartitionByLexeme(words[1:], "from")
+	if !found {
+		return nil, parseErr("expected 'from' and the file to borrow from", words[len(words)-1])
+	}
+	name, err := p.parseIdent(left)
+	if err != nil {
+		return nil, err
+	}
+	path, err := p.parseExpr(right)
+	if err != nil {
+		return nil, err
+	}
+	node := AstBorrow{name: name.(AstIdent), path: path, spn: spanOf(words)}
 	return node, nil
 }
 
@@ -216,10 +253,12 @@ func (p *Parser) parseLoop(words []Token) (Ast, error) {
 		return nil, err
 	}
 	else_block := []Ast{}
+	var otherwise Span
 	if p.peek().Ty == TOKEN_KW_OTHERWISE {
 		if p.debug {
 			log.Printf(" saw otherwise after loop, parsing else block now\n")
 		}
+		otherwise = p.peek().Spn
 		words := p.consumeLine()
 		if len(words) != 1 {
 			return nil, parseErr("unexpected tokens after otherwise block", words[0])
@@ -233,6 +272,8 @@ func (p *Parser) parseLoop(words []Token) (Ast, error) {
 		cond:       cond,
 		block:      block,
 		else_block: else_block,
+		spn:        spanOf(words),
+		otherwise:  otherwise,
 	}
 	return node, nil
 }
@@ -253,7 +294,9 @@ func (p *Parser) parseConditional(words []Token) (Ast, error) {
 	}
 
 	else_block := []Ast{}
+	var otherwise Span
 	if p.peek().Ty == TOKEN_KW_OTHERWISE {
+		otherwise = p.peek().Spn
 		line := p.consumeLine()
 		// todo: this could actually be parsed here
 		// for now, we expect one tokens: OTHERWISE
@@ -278,6 +321,8 @@ func (p *Parser) parseConditional(words []Token) (Ast, error) {
 		cond:       cond,
 		if_block:   if_block,
 		else_block: else_block,
+		spn:        spanOf(words),
+		otherwise:  otherwise,
 	}
 	return node, nil
 }
@@ -302,6 +347,8 @@ func (p *Parser) parseExpr(words []Token) (Ast, error) {
 		node := AstFunCall{
 			fun:  fun,
 			args: args,
+			of:   true,
+			spn:  spanOf(words),
 		}
 		return node, nil
 	}
@@ -323,14 +370,21 @@ func (p *Parser) parseExpr(words []Token) (Ast, error) {
 			if p.debug {
 				log.Printf(" return AstFunCall\n")
 			}
+			opword := words[len(left)]
 			node := AstFunCall{
-				fun:  AstIdent{name: infix.symbol},
+				fun:  AstIdent{name: infix.symbol, spn: opword.Spn},
 				args: []Ast{lexpr, rexpr},
+				spn:  spanOf(words),
 			}
 			return node, nil
 		}
 	}
 
+	if len(words) == 0 {
+		// like 'show of 1 plus' with nothing after the plus
+		return nil, parseErr("expected something here, but the line ended", Token{Spn: p.previousSpan()})
+	}
+
 	// prefix operators
 	if words[0].Ty == TOKEN_KW_THE {
 		return p.parseIdent(words)
@@ -344,9 +398,14 @@ func (p *Parser) parseBlock() ([]Ast, error) {
 	if p.debug {
 		log.Printf("parseBlock \n")
 	}
+	ast := make([]Ast, 0, 5)
+	// blank lines (or comments) can come before the block is indented
+	for p.peek().Ty == TOKEN_NEWLINE {
+		p.pos += 1
+		ast = append(ast, AstLiteral{value: BsNilVal{}, spn: p.previousSpan()})
+	}
 	p.consumeOrFail(TOKEN_BEGIN_INDENT)
 
-	ast := make([]Ast, 0, 5)
 	for p.hasTokens() && p.peek().Ty != TOKEN_END_INDENT {
 		line := p.consumeLine()
 		n, err := p.parseStmnt(line)
@@ -368,9 +427,39 @@ func (p *Parser) parseFunCall(words []Token) (Ast, error) {
 	if len(words) == 0 {
 		return nil, errors.New("need tokens inside function call")
 	}
+	if head, rest, ok := p.parsePhrase(words); ok {
+		args, err := p.parseArgs(rest)
+		if err != nil {
+			return nil, err
+		}
+		return AstFunCall{fun: head, args: args, spn: spanOf(words)}, nil
+	}
+	if len(words) == 1 && words[0].Ty == TOKEN_WORD {
+		// a bare word on its own invokes the procedure with nothing
+		node := AstFunCall{
+			fun:  AstIdent{name: words[0].Lex, spn: words[0].Spn},
+			args: []Ast{},
+			spn:  words[0].Spn,
+		}
+		return node, nil
+	}
 	if len(words) == 1 {
 		return p.parseAtom(words[0])
 	}
+	if len(words) == 2 && words[0].Ty == TOKEN_NUMBER && words[1].Ty == TOKEN_WORD {
+		// a quantity like '3 seconds' invokes the unit with the number
+		number, err := p.parseAtom(words[0])
+		if err != nil {
+			return nil, err
+		}
+		node := AstFunCall{
+			fun:      AstIdent{name: words[1].Lex, spn: words[1].Spn},
+			args:     []Ast{number},
+			quantity: true,
+			spn:      spanOf(words),
+		}
+		return node, nil
+	}
 
 	head, err := p.parseFunHead(words[:1])
 	if err != nil {
@@ -384,6 +473,7 @@ func (p *Parser) parseFunCall(words []Token) (Ast, error) {
 	node := AstFunCall{
 		fun:  head,
 		args: args,
+		spn:  spanOf(words),
 	}
 
 	if p.debug {
@@ -399,11 +489,15 @@ func (p *Parser) parseFunHead(words []Token) (Ast, error) {
 	if len(words) == 0 {
 		return nil, parseErr("invocing function needs a parameter", eof())
 	}
+	if head, rest, ok := p.parsePhrase(words); ok && len(rest) == 0 {
+		return head, nil
+	}
 	if len(words) == 1 {
 		if words[0].Ty == TOKEN_WORD {
 			// only case where a single bare word can become an identifier: when it is invoked as a function
 			node := AstIdent{
 				name: words[0].Lex,
+				spn:  words[0].Spn,
 			}
 			return node, nil
 		}
@@ -412,6 +506,32 @@ func (p *Parser) parseFunHead(words []Token) (Ast, error) {
 	}
 	return p.parseExpr(words)
 }
+
+// 'ask for a number': a word, 'for' and the words right after it name one procedure,
+// whatever follows are its arguments
+func (p *Parser) parsePhrase(words []Token) (AstIdent, []Token, bool) {
+	if len(words) < 2 || words[0].Ty != TOKEN_WORD || words[1].Ty != TOKEN_KW_FOR {
+		return AstIdent{}, nil, false
+	}
+	end := 2
+	for end < len(words) && words[end].Ty == TOKEN_WORD && words[end].Lex != "and" {
+		end += 1
+	}
+	lexes := make([]string, end)
+	for i, word := range words[:end] {
+		lexes[i] = word.Lex
+	}
+	if p.debug {
+		log.Printf(" phrase %s\n", strings.Join(lexes, " "))
+	}
+	return AstIdent{name: strings.Join(lexes, " "), spn: spanOf(words[:end])}, words[end:], true
+}
+
+func isPhrase(name string) bool {
+	words := strings.Fields(name)
+	return len(words) > 1 && words[1] == "for"
+}
+
 func (p *Parser) parseArgs(words []Token) ([]Ast, error) {
 	if p.debug {
 		log.Printf("parseArgs %#v\n", words)
@@ -422,12 +542,15 @@ func (p *Parser) parseArgs(words []Token) ([]Ast, error) {
 		return []Ast{}, nil
 	}
 
-	// todo: multiple args better
-	node, err := p.parseExpr(words)
-	if err != nil {
-		return nil, err
+	// several arguments are separated by 'and'
+	list := []Ast{}
+	for _, tokens := range SplitByAnd(words) {
+		node, err := p.parseExpr(tokens)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, node)
 	}
-	list := []Ast{node}
 	return list, nil
 }
 
@@ -436,6 +559,9 @@ func (p *Parser) parseIdent(words []Token) (Ast, error) {
 		log.Printf("parseIdent %#v\n", words)
 	}
 
+	if len(words) == 0 {
+		return nil, parseErr("expected a name, like 'the count'", Token{Spn: p.previousSpan()})
+	}
 	if words[0].Ty != TOKEN_KW_THE {
 		return nil, parseErr(fmt.Sprintf("expected 'the' keyword to begin identifier, found %#v", words[0]), words[0])
 	}
@@ -447,7 +573,7 @@ func (p *Parser) parseIdent(words []Token) (Ast, error) {
 	if p.debug {
 		log.Printf(" return AstIdent\n")
 	}
-	return AstIdent{name: name}, nil
+	return AstIdent{name: name, spn: spanOf(words)}, nil
 }
 
 func (p *Parser) parseAtom(word Token) (Ast, error) {
@@ -459,7 +585,7 @@ func (p *Parser) parseAtom(word Token) (Ast, error) {
 		var value int64
 		rc, err := fmt.Sscanf(word.Lex, "%d", &value)
 		if err != nil {
-			return nil, err
+			return nil, parseErr("not a valid number", word)
 		}
 		if rc == 0 {
 			return nil, parseErr("not a valid number", word)
@@ -468,13 +594,14 @@ func (p *Parser) parseAtom(word Token) (Ast, error) {
 		if p.debug {
 			log.Printf(" return AstLiteral\n")
 		}
-		node := AstLiteral{value: literal}
+		node := AstLiteral{value: literal, spn: word.Spn}
 		return node, nil
 	} else if word.Ty == TOKEN_KW_TRUE {
 		node := AstLiteral{
 			value: BsBooleVal{
 				value: true,
 			},
+			spn: word.Spn,
 		}
 		if p.debug {
 			log.Printf(" return AstLiteral\n")
@@ -485,6 +612,7 @@ func (p *Parser) parseAtom(word Token) (Ast, error) {
 			value: BsBooleVal{
 				value: false,
 			},
+			spn: word.Spn,
 		}
 		if p.debug {
 			log.Printf(" return AstLiteral\n")
@@ -492,7 +620,7 @@ func (p *Parser) parseAtom(word Token) (Ast, error) {
 		return node, nil
 	} else if word.Ty == TOKEN_TEXT {
 		value := BsStrVal{value: word.Lex}
-		node := AstLiteral{value: value}
+		node := AstLiteral{value: value, spn: word.Spn}
 		if p.debug {
 			log.Printf(" return AstLiteral\n")
 		}
@@ -502,6 +630,26 @@ func (p *Parser) parseAtom(word Token) (Ast, error) {
 	}
 }
 
+// spans
+
+// from the start of the first token to the end of the last one
+func spanOf(words []Token) Span {
+	if len(words) == 0 {
+		return Span{}
+	}
+	spn := words[0].Spn
+	spn.End = words[len(words)-1].Spn.End
+	return spn
+}
+
+// the span of the token that was consumed last
+func (p *Parser) previousSpan() Span {
+	if p.pos < 1 || p.pos > len(p.tokens) {
+		return Span{}
+	}
+	return p.tokens[p.pos-1].Spn
+}
+
 // error reporting
 
 func parseErr(msg string, token Token) error {
@@ -536,6 +684,23 @@ func PartitionByLexeme(words []Token, split string) ([]Token, []Token, bool) {
 	return left, right, true
 }
 
+// cuts a list of words at every 'and' that is a word of its own.
+// an 'and' after an 'of' belongs to that call: 'show of maximum of 3 and 9' shows one thing
+func SplitByAnd(words []Token) [][]Token {
+	groups := [][]Token{}
+	begin := 0
+	for i, tok := range words {
+		if tok.Ty == TOKEN_KW_OF {
+			break
+		}
+		if tok.Ty == TOKEN_WORD && tok.Lex == "and" {
+			groups = append(groups, words[begin:i])
+			begin = i + 1
+		}
+	}
+	return append(groups, words[begin:])
+}
+
 func Partition(words []Token, split TokenType) ([]Token, []Token, bool) {
 	idx := FindFirst(words, func(tok Token) bool { return tok.Ty == split })
 	if idx == -1 {
@@ -564,6 +729,10 @@ func JoinTokens(words []Token) (string, error) {
 		if w.Ty != TOKEN_WORD {
 			return "", parseErr(fmt.Sprintf("expected TOKEN_WORD, found %#v", w.Ty), w)
 		}
+		if w.Lex == "and" {
+			// it could never be read back, 'the salt and pepper' is two arguments
+			return "", parseErr("'and' separates parameters and arguments, it can not be part of a name", w)
+		}
 		b.WriteString(w.Lex)
 	}
 	return b.String(), nil
@@ -0,0 +1,280 @@
+package boomslang
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Preprocessing: the lines of a source get one pass before the lexer sees them.
+// Directives are written like comments without a space after the #,
+// so anything that does not preprocess (the formatter, the linter) just skips them
+//
+//	#include other.bs           the lines of another file, right here
+//	#define NAME some words     from now on the word NAME means some words
+//	#if defined NAME            the lines up to #otherwise or #end are only kept
+//	#if version 0.1             when the condition holds, 'not' turns it around
+//	#otherwise
+//	#end
+
+// the version of the language, #if version compares against this
+const VERSION string = "0.1.0"
+
+// Sources that know where their lines really came from, the lexer puts that in spans
+type MappedSource interface {
+	Source
+	// the source name and line number of the line read last
+	Origin() (string, int)
+}
+
+type ppFile struct {
+	source Source
+	lineno int
+}
+
+type ppBranch struct {
+	keeping bool // the lines of this branch make it through
+	taken   bool // one of the branches of this #if already did
+	outer   bool // the #if itself is in lines that make it through
+	spn     Span
+}
+
+type Preprocessor struct {
+	debug    bool
+	files    []ppFile // the innermost include is last
+	branches []ppBranch
+	macros   map[string]string
+	defined  map[string]bool
+	origin   Span
+	withheld Capability // what the program is not allowed, #include needs the file system
+}
+
+func MakePreprocessor(opts *Opts, source Source) *Preprocessor {
+	pp := new(Preprocessor)
+	pp.debug = opts.debug&DBG_PRE > 0
+	pp.files = []ppFile{{source: source}}
+	pp.macros = make(map[string]string)
+	pp.defined = make(map[string]bool)
+	pp.withheld = opts.withheld()
+	for _, name := range opts.defines {
+		pp.defined[name] = true
+	}
+	return pp
+}
+
+func (pp *Preprocessor) Name() string {
+	return pp.files[0].source.Name()
+}
+
+// the source the program was read from, not any of its includes
+func (pp *Preprocessor) Root() Source {
+	return pp.files[0].source
+}
+
+func (pp *Preprocessor) Origin() (string, int) {
+	return pp.origin.SourceName, pp.origin.Lineno
+}
+
+func (pp *Preprocessor) ReadLine() (string, error) {
+	for len(pp.files) > 0 {
+		file := &pp.files[len(pp.files)-1]
+		line, err := file.source.ReadLine()
+		if err == io.EOF && len(pp.files) > 1 {
+			pp.files = pp.files[:len(pp.files)-1]
+			continue
+		} else if err == io.EOF && len(pp.branches) > 0 {
+			return "", pp.errorAt(pp.branches[len(pp.branches)-1].spn, "this #if is never closed with an #end")
+		} else if err != nil {
+			return line, err
+		}
+		file.lineno += 1
+		pp.origin = Span{SourceName: file.source.Name(), Lineno: file.lineno}
+
+		directive, arg, isDirective := pp.directive(line)
+		if isDirective {
+			if err := pp.handle(directive, arg); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if !pp.keeping() {
+			continue
+		}
+		line = pp.expand(line)
+		if pp.debug {
+			log.Printf("%s:%d | %s", pp.origin.SourceName, pp.origin.Lineno, strings.TrimRight(line, "\r\n"))
+		}
+		return line, nil
+	}
+	return "", io.EOF
+}
+
+// splits off a directive, lines like '#todo' are left alone as comments
+func (pp *Preprocessor) directive(line string) (string, string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "#") {
+		return "", "", false
+	}
+	directive, arg, _ := strings.Cut(trimmed[1:], " ")
+	switch directive {
+	case "include", "define", "if", "otherwise", "end":
+		return directive, strings.TrimSpace(arg), true
+	}
+	return "", "", false
+}
+
+func (pp *Preprocessor) handle(directive string, arg string) error {
+	// conditionals have to be followed even where lines are dropped, to find their #end
+	switch directive {
+	case "if":
+		branch := ppBranch{outer: pp.keeping(), spn: pp.origin}
+		if branch.outer {
+			holds, err := pp.condition(arg)
+			if err != nil {
+				return err
+			}
+			branch.keeping, branch.taken = holds, holds
+		}
+		pp.branches = append(pp.branches, branch)
+		return nil
+	case "otherwise":
+		if len(pp.branches) == 0 {
+			return pp.errorAt(pp.origin, "there is no #if for this #otherwise")
+		}
+		branch := &pp.branches[len(pp.branches)-1]
+		branch.keeping = branch.outer && !branch.taken
+		branch.taken = true
+		return nil
+	case "end":
+		if len(pp.branches) == 0 {
+			return pp.errorAt(pp.origin, "there is no #if for this #end")
+		}
+		pp.branches = pp.branches[:len(pp.branches)-1]
+		return nil
+	}
+
+	if !pp.keeping() {
+		return nil
+	}
+	switch directive {
+	case "include":
+		return pp.include(arg)
+	case "define":
+		name, replacement, _ := strings.Cut(arg, " ")
+		if name == "" {
+			return pp.errorAt(pp.origin, "#define needs a name")
+		}
+		pp.defined[name] = true
+		pp.macros[name] = strings.TrimSpace(replacement)
+	}
+	return nil
+}
+
+func (pp *Preprocessor) keeping() bool {
+	return len(pp.branches) == 0 || pp.branches[len(pp.branches)-1].keeping
+}
+
+// 'defined NAME' or 'version 0.1', either one can start with 'not'
+func (pp *Preprocessor) condition(arg string) (bool, error) {
+	words := strings.Fields(arg)
+	negate := len(words) > 0 && words[0] == "not"
+	if negate {
+		words = words[1:]
+	}
+	if len(words) != 2 {
+		return false, pp.errorAt(pp.origin, "#if needs 'defined NAME' or 'version NUMBER'")
+	}
+	var holds bool
+	switch words[0] {
+	case "defined":
+		holds = pp.defined[words[1]]
+	case "version":
+		atLeast, err := versionAtLeast(VERSION, words[1])
+		if err != nil {
+			return false, pp.errorAt(pp.origin, err.Error())
+		}
+		holds = atLeast
+	default:
+		return false, pp.errorAt(pp.origin, "#if needs 'defined NAME' or 'version NUMBER'")
+	}
+	return holds != negate, nil
+}
+
+// compares dotted versions part by part, missing parts count as 0
+func versionAtLeast(have string, want string) (bool, error) {
+	haveParts, wantParts := strings.Split(have, "."), strings.Split(want, ".")
+	for i := 0; i < len(haveParts) || i < len(wantParts); i += 1 {
+		var h, w int
+		if i < len(haveParts) {
+			h, _ = strconv.Atoi(haveParts[i])
+		}
+		if i < len(wantParts) {
+			n, err := strconv.Atoi(wantParts[i])
+			if err != nil {
+				return false, fmt.Errorf("'%s' is not a version", want)
+			}
+			w = n
+		}
+		if h != w {
+			return h > w, nil
+		}
+	}
+	return true, nil
+}
+
+// included paths are relative to the file doing the including
+func (pp *Preprocessor) include(path string) error {
+	if path == "" {
+		return pp.errorAt(pp.origin, "#include needs a file")
+	}
+	if pp.withheld&CAP_FILESYSTEM != 0 {
+		return pp.errorAt(pp.origin, withheldByPolicy("#include", CAP_FILESYSTEM))
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(pp.origin.SourceName), path)
+	}
+	for _, file := range pp.files {
+		if filepath.Clean(file.source.Name()) == path {
+			return pp.errorAt(pp.origin, fmt.Sprintf("'%s' ends up including itself", path))
+		}
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return pp.errorAt(pp.origin, fmt.Sprintf("could not include '%s': %v", path, errors.Unwrap(err)))
+	}
+	source := FileSource{path, bufio.NewReader(strings.NewReader(string(text)))}
+	pp.files = append(pp.files, ppFile{source: source})
+	return nil
+}
+
+// swaps whole words for their macros, keeping the space between words as it was
+func (pp *Preprocessor) expand(line string) string {
+	if len(pp.macros) == 0 {
+		return line
+	}
+	words, offsets := FieldsWithOffsets(line)
+	b := new(strings.Builder)
+	last := 0
+	for i, word := range words {
+		if strings.HasPrefix(word, "#") {
+			break // the rest is a comment
+		}
+		if replacement, ok := pp.macros[word]; ok {
+			b.WriteString(line[last:offsets[i]])
+			b.WriteString(replacement)
+			last = offsets[i] + len(word)
+		}
+	}
+	b.WriteString(line[last:])
+	return b.String()
+}
+
+func (pp *Preprocessor) errorAt(spn Span, msg string) error {
+	return LexError{msg: msg, spn: spn}
+}
@@ -0,0 +1,75 @@
+package boomslang
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Builtins for randomness. Every program gets a generator of its own,
+// started from --seed when there is one so the same program makes the same choices every time
+
+func newRandom(opts *Opts) *rand.Rand {
+	seed := time.Now().UnixNano()
+	if opts.hasSeed {
+		seed = opts.seed
+	}
+	return rand.New(rand.NewSource(seed))
+}
+
+// ==========================================
+//
+//	random
+//	  returns a number between the two given, both included
+func (r BuiltinRegistry) RegisterRandom(env *BsEnv) {
+	env.provide(CAP_RANDOMNESS, "random", MustWrapFunc("random", func(env *BsEnv, low int64, high int64) (int64, error) {
+		if low > high {
+			return 0, fmt.Errorf("there are no numbers from %d to %d", low, high)
+		}
+		return randomBetween(env.program.random, low, high), nil
+	}))
+}
+
+func randomBetween(random *rand.Rand, low int64, high int64) int64 {
+	// counted unsigned, the distance between them fits even when high-low+1 does not
+	span := uint64(high) - uint64(low)
+	if span < math.MaxInt64 {
+		return low + random.Int63n(int64(span)+1)
+	}
+	// wider than Int63n goes: draw until it lands inside, which at least half of the draws do
+	for {
+		if n := random.Uint64(); n <= span {
+			return int64(uint64(low) + n)
+		}
+	}
+}
+
+// ==========================================
+//
+//	pick
+//	  returns one of the items in a list
+func (r BuiltinRegistry) RegisterPick(env *BsEnv) {
+	env.provide(CAP_RANDOMNESS, "pick", MustWrapFunc("pick", func(env *BsEnv, items []BsValue) BsValue {
+		if len(items) == 0 {
+			return BsTypeErr{expected: "list with something in it", value: BsListVal{items: items}}
+		}
+		return items[env.program.random.Intn(len(items))]
+	}))
+}
+
+// ==========================================
+//
+//	shuffle
+//	  returns the items of a list in a new order,
+//	  the list itself stays as it was
+func (r BuiltinRegistry) RegisterShuffle(env *BsEnv) {
+	env.provide(CAP_RANDOMNESS, "shuffle", MustWrapFunc("shuffle", func(env *BsEnv, items []BsValue) []BsValue {
+		shuffled := make([]BsValue, len(items))
+		copy(shuffled, items)
+		env.program.random.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+		return shuffled
+	}))
+}
@@ -0,0 +1,165 @@
+package boomslang
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	PROMPT              string = "> "
+	PROMPT_CONTINUATION string = "... "
+)
+
+type replsource struct {
+	buf    *bufio.Reader
+	ostr   io.Writer
+	prompt string
+	editor *lineEditor // only when talking to a terminal
+}
+
+func makeReplSource(opts *Opts) *replsource {
+	source := &replsource{
+		buf:  bufio.NewReader(opts.istr),
+		ostr: opts.ostr,
+	}
+	if file, ok := opts.istr.(*os.File); ok && isTerminal(int(file.Fd())) {
+		source.editor = makeLineEditor(source.buf, opts.ostr, int(file.Fd()), historyPath())
+	}
+	return source
+}
+func (s *replsource) Name() string {
+	return "<repl>"
+}
+func (s *replsource) ReadLine() (string, error) {
+	if s.editor != nil {
+		return s.editor.ReadLine(s.prompt)
+	}
+	fmt.Fprint(s.ostr, s.prompt)
+	return readLine(s.buf)
+}
+
+// Runs until the input runs out or someone asks to exit, returns the exit code
+func repl(opts *Opts) int {
+	env := MakeEnv(opts)
+	LoadBuiltins(env)
+	LoadArguments(env, opts.args)
+
+	fmt.Fprintf(opts.ostr, "boomslang %s >>>>\n", VERSION)
+
+	source := makeReplSource(opts)
+	// ask reads from the same buffer as the repl, or it would swallow the next statements
+	env.program.input = source.buf
+	if source.editor != nil {
+		source.editor.complete = func(prefix string) []string {
+			return completeNames(env, prefix)
+		}
+	}
+
+	for {
+		rc, val, done := runrepl(opts, source, env)
+		if done {
+			return rc
+		}
+		if val != nil {
+			fmt.Fprintf(opts.ostr, "(%d) => %s\n", rc, val.PrettyPrint())
+		}
+	}
+}
+
+// Reads one statement. Anything that opens a block (if, while, by ... we mean)
+// keeps on reading indented lines until a blank line closes it
+func readStatement(opts *Opts, source *replsource) (string, error) {
+	source.prompt = PROMPT
+	line, err := source.ReadLine()
+	if err != nil {
+		return line, err
+	}
+	if !opensBlock(opts, line) {
+		return line, nil
+	}
+
+	b := new(strings.Builder)
+	b.WriteString(strings.TrimSuffix(line, "\n") + "\n")
+	source.prompt = PROMPT_CONTINUATION
+	for {
+		line, err := source.ReadLine()
+		if err != nil || strings.TrimSpace(line) == "" {
+			// whatever we have buffered is the whole block
+			break
+		}
+		b.WriteString(strings.TrimSuffix(line, "\n") + "\n")
+	}
+	return b.String(), nil
+}
+
+// a statement is incomplete when the block it opens still has to follow
+func opensBlock(opts *Opts, line string) bool {
+	lexer := MakeLexer(opts, MakeReaderSource("<repl>", strings.NewReader(line)))
+	tokens, err := lexer.LexLine()
+	if err != nil || len(tokens) == 0 {
+		return false
+	}
+	switch tokens[0].Ty {
+	case TOKEN_KW_IF, TOKEN_KW_WHILE, TOKEN_KW_BY:
+		return true
+	}
+	return false
+}
+
+// Evaluates a single statement.
+// Reports done when there is nothing left to evaluate, either by EOF or by exiting
+func runrepl(opts *Opts, source *replsource, env *BsEnv) (int, BsValue, bool) {
+	stmnt, err := readStatement(opts, source)
+	if err == io.EOF {
+		// put the shell prompt on its own line again
+		fmt.Fprintf(opts.ostr, "\n")
+		return 0, nil, true
+	}
+	if err != nil {
+		fmt.Fprintf(opts.estr, "\033[0;31m I am very sorry, but I could not understand this file due to: %v\n\033[0m ", err)
+		return EXIT_LEX_FAILURE, nil, false
+	}
+	if strings.TrimSpace(stmnt) == "exit" {
+		return 0, nil, true
+	}
+	if strings.HasPrefix(strings.TrimSpace(stmnt), ":") {
+		return runMetaCommand(opts, env, strings.TrimSpace(stmnt))
+	}
+
+	lexer := MakeLexer(opts, MakeReaderSource(source.Name(), strings.NewReader(stmnt)))
+	tokens, err := lexer.Lex()
+	if err != nil {
+		fmt.Fprintf(opts.estr, "\033[0;31m I am very sorry, but I could not understand this file due to: %v\n\033[0m ", err)
+		return EXIT_LEX_FAILURE, nil, false
+	}
+
+	parser := MakeParser(opts, tokens)
+	ast, err := parser.Parse()
+	if err != nil {
+		fmt.Fprintf(opts.estr, "\033[0;31m I am sorry, but I simply could not understand the file you gave me: %v\n\033[0m ", err)
+		return EXIT_PARSE_FAILURE, nil, false
+	}
+
+	if opts.debug != 0 {
+		fmt.Fprintf(opts.ostr, "============================ BEGIN EVAL ===========================\n")
+	}
+
+	// every statement gets the limits a whole program would
+	done := env.limit(context.Background(), opts.evalLimits())
+	val := EvalAll(env, ast)
+	done()
+	if exit, ok := unwindCause(val).(BsExitExc); ok {
+		return exit.code, nil, true
+	}
+	if val.ShouldUnwind() {
+		fmt.Fprintf(opts.estr, "\033[0;31m Failure occured during runtime:\n%v\033[0m\n", val.PrettyPrint())
+		return EXIT_RUNTIME_FAILURE, val, false
+	}
+
+	return 0, val, false
+
+}
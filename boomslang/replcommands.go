@@ -0,0 +1,176 @@
+package boomslang
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/davecgh/go-spew/spew"
+)
+
+// Colon commands for poking at the repl itself rather than running boomslang
+type metacommand struct {
+	name string
+	args string
+	help string
+	run  func(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool)
+}
+
+var metacommands []metacommand
+
+func init() {
+	// filled in here since :help needs to look at the list itself
+	metacommands = []metacommand{
+		{"names", "", "show every name that is currently bound", metaNames},
+		{"type", "<expr>", "evaluate an expression and show its type", metaType},
+		{"ast", "<stmnt>", "show how a statement is parsed", metaAst},
+		{"tokens", "<line>", "show how a line is lexed", metaTokens},
+		{"load", "<file.bs>", "run a file inside of this session", metaLoad},
+		{"reset", "", "forget everything that was defined", metaReset},
+		{"debug", "[lex,parse,eval]", "toggle debug output", metaDebug},
+		{"help", "", "show this list", metaHelp},
+		{"quit", "", "leave the repl", metaQuit},
+	}
+}
+
+func runMetaCommand(opts *Opts, env *BsEnv, line string) (int, BsValue, bool) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+	for _, cmd := range metacommands {
+		if cmd.name == name {
+			return cmd.run(opts, env, arg)
+		}
+	}
+	fmt.Fprintf(opts.estr, "Sorry, I do not know the command ':%s', try :help\n", name)
+	return EXIT_BAD_OPTS, nil, false
+}
+
+// names that are not secret, starting with the prefix
+func completeNames(env *BsEnv, prefix string) []string {
+	matches := make([]string, 0)
+	for _, name := range env.Names() {
+		if strings.HasPrefix(name, "_") {
+			continue
+		}
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+func metaNames(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	for _, name := range completeNames(env, arg) {
+		fmt.Fprintf(opts.ostr, "%s => %s\n", name, env.Lookup(name).PrettyPrint())
+	}
+	return 0, nil, false
+}
+
+func metaType(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	ast, rc := parseMetaArg(opts, arg)
+	if ast == nil {
+		return rc, nil, false
+	}
+	done := env.limit(context.Background(), opts.evalLimits())
+	val := EvalAll(env, ast)
+	done()
+	if val.ShouldUnwind() {
+		fmt.Fprintf(opts.estr, "\033[0;31m Failure occured during runtime:\n%v\033[0m\n", val.PrettyPrint())
+		return EXIT_RUNTIME_FAILURE, nil, false
+	}
+	fmt.Fprintf(opts.ostr, "%s\n", bsTypeName(val))
+	return 0, nil, false
+}
+
+func metaAst(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	ast, rc := parseMetaArg(opts, arg)
+	if ast == nil {
+		return rc, nil, false
+	}
+	fmt.Fprintf(opts.ostr, "%s", spew.Sdump(ast))
+	return 0, nil, false
+}
+
+func metaTokens(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	lexer := MakeLexer(opts, MakeReaderSource("<repl>", strings.NewReader(arg)))
+	tokens, err := lexer.LexLine()
+	if err != nil {
+		fmt.Fprintf(opts.estr, "\033[0;31m I am very sorry, but I could not understand this file due to: %v\n\033[0m ", err)
+		return EXIT_LEX_FAILURE, nil, false
+	}
+	for _, tok := range tokens {
+		fmt.Fprintf(opts.ostr, "%-20s %q\n", tok.Ty, tok.Lex)
+	}
+	return 0, nil, false
+}
+
+func metaLoad(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	file, err := os.Open(arg)
+	if err != nil {
+		fmt.Fprintf(opts.estr, "Error opening file '%s': %s\n", arg, err)
+		return EXIT_BAD_FILE, nil, false
+	}
+	defer file.Close()
+	done := env.limit(context.Background(), opts.evalLimits())
+	rc, _ := run(opts, FileSource{arg, bufio.NewReader(file)}, env)
+	done()
+	return rc, nil, false
+}
+
+func metaReset(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	env.symbols = make(map[string]BsValue, 50)
+	// a budget as fresh as the one the session started with, the old names are gone too
+	env.program.budget = evalBudget{}
+	LoadBuiltins(env)
+	LoadArguments(env, opts.args)
+	fmt.Fprintf(opts.ostr, "all forgotten\n")
+	return 0, nil, false
+}
+
+func metaDebug(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	if arg != "" {
+		targets, err := parseDebugTargets(arg)
+		if err != nil {
+			fmt.Fprintf(opts.estr, "Bad choice for :debug, %v\n", err)
+			return EXIT_BAD_OPTS, nil, false
+		}
+		opts.debug ^= targets
+		for scope := env; scope != nil; scope = scope.parent {
+			scope.debug = opts.debug&DBG_EVAL != 0
+		}
+	}
+	fmt.Fprintf(opts.ostr, "debugging lex: %v, parse: %v, eval: %v\n",
+		opts.debug&DBG_LEX != 0, opts.debug&DBG_PARSE != 0, opts.debug&DBG_EVAL != 0)
+	return 0, nil, false
+}
+
+func metaHelp(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	for _, cmd := range metacommands {
+		fmt.Fprintf(opts.ostr, "  :%-25s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.help)
+	}
+	fmt.Fprintf(opts.ostr, "  %-26s %s\n", "exit", "also leaves the repl")
+	return 0, nil, false
+}
+
+func metaQuit(opts *Opts, env *BsEnv, arg string) (int, BsValue, bool) {
+	return 0, nil, true
+}
+
+// lexes and parses the argument of a command, reporting failures like the repl does
+func parseMetaArg(opts *Opts, arg string) ([]Ast, int) {
+	lexer := MakeLexer(opts, MakeReaderSource("<repl>", strings.NewReader(arg)))
+	tokens, err := lexer.Lex()
+	if err != nil {
+		fmt.Fprintf(opts.estr, "\033[0;31m I am very sorry, but I could not understand this file due to: %v\n\033[0m ", err)
+		return nil, EXIT_LEX_FAILURE
+	}
+	parser := MakeParser(opts, tokens)
+	ast, err := parser.Parse()
+	if err != nil {
+		fmt.Fprintf(opts.estr, "\033[0;31m I am sorry, but I simply could not understand the file you gave me: %v\n\033[0m ", err)
+		return nil, EXIT_PARSE_FAILURE
+	}
+	return ast, 0
+}
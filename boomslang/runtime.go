@@ -1,9 +1,12 @@
-package main
+package boomslang
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
+	"sort"
 	"strings"
 )
 
@@ -16,15 +19,52 @@ type BsEnv struct {
 	parent     *BsEnv
 	childCount int
 	id         string
+	program    *programState         // shared by every scope of one program
+	library    bool                  // holds the builtins and the standard library, not the program
+	withheld   map[string]Capability // builtins left out of a library scope, by what they need
+}
+
+// What every scope of one program reaches for, whichever scope it is in
+type programState struct {
+	input    *bufio.Reader // what ask reads lines from
+	random   *rand.Rand
+	clock    Clock
+	hook     EvalHook // told about everything that gets evaluated, nil for nobody
+	modules  *moduleLoader
+	budget   evalBudget
+	withheld Capability // what the program is not allowed to reach for
+}
+
+// Lets tools like the debugger follow along while a program runs
+type EvalHook interface {
+	// called before each statement, an unwinding value stops the program right there
+	Statement(env *BsEnv, node Ast) BsValue
+	// called around every invocation of a procedure written in boomslang
+	Enter(env *BsEnv, fun BsRuntimeFunc)
+	Leave(env *BsEnv, fun BsRuntimeFunc)
+	// called after each statement with whatever it came to, unwinding values included
+	Evaluated(env *BsEnv, node Ast, value BsValue)
 }
 
 func MakeEnv(opts *Opts) *BsEnv {
+	return makeScope(opts, &programState{
+		input:    bufio.NewReader(opts.istr),
+		random:   newRandom(opts),
+		clock:    newClock(opts),
+		modules:  makeModuleLoader(opts),
+		withheld: opts.withheld(),
+	})
+}
+
+// a fresh global scope for program, modules get one of these each
+func makeScope(opts *Opts, program *programState) *BsEnv {
 	env := new(BsEnv)
 	env.debug = (opts.debug & DBG_EVAL) != 0
 	env.symbols = make(map[string]BsValue, 50)
 	env.istr = opts.istr
 	env.ostr = opts.ostr
 	env.estr = opts.estr
+	env.program = program
 
 	if env.debug {
 		log.Printf("creating fresh global scope at %p\n", env)
@@ -38,6 +78,7 @@ func (env *BsEnv) NewChild() *BsEnv {
 	cpy.istr = env.istr
 	cpy.ostr = env.ostr
 	cpy.estr = env.estr
+	cpy.program = env.program
 	cpy.parent = env
 
 	if env.debug {
@@ -45,6 +86,20 @@ func (env *BsEnv) NewChild() *BsEnv {
 	}
 	return cpy
 }
+
+// a fresh scope between env and its parent, env sees everything in it
+func (env *BsEnv) insertParent() *BsEnv {
+	scope := new(BsEnv)
+	scope.debug = env.debug
+	scope.symbols = make(map[string]BsValue, 50)
+	scope.istr = env.istr
+	scope.ostr = env.ostr
+	scope.estr = env.estr
+	scope.program = env.program
+	scope.parent = env.parent
+	env.parent = scope
+	return scope
+}
 func (env *BsEnv) AssignName(name string, value BsValue) {
 	if env.debug {
 		log.Printf("[env %p] assigning symbol '%s' to %v\n", env, name, value)
@@ -56,12 +111,31 @@ func (env *BsEnv) Lookup(name string) BsValue {
 	if ok {
 		return val
 	}
+	if capability, ok := env.withheld[name]; ok {
+		return BsNameErr{name: name, withheld: capability}
+	}
 	if env.parent != nil {
 		return env.parent.Lookup(name)
 	}
 	return BsNameErr{name: name}
 }
 
+// All of the names visible from here, in every enclosing scope
+func (env *BsEnv) Names() []string {
+	seen := make(map[string]bool)
+	names := make([]string, 0, len(env.symbols))
+	for scope := env; scope != nil; scope = scope.parent {
+		for name := range scope.symbols {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // For collecting context on the way up the stack
 type BsUnwindCtx struct {
 	init   BsValue // the value that was initially thrown
@@ -75,12 +149,36 @@ func (v BsUnwindCtx) PrettyPrint() string {
 	b := new(strings.Builder)
 	b.WriteString(v.init.PrettyPrint())
 	b.WriteString("\n")
-	for i, frame := range v.frames {
+	b.WriteString(formatFrames(v.frames))
+	return b.String()
+}
+
+// how many frames are shown at either end of a very deep stack
+const SHOWN_FRAMES int = 10
+
+// one line per frame, innermost first. The middle of very deep stacks is left out
+func formatFrames(frames []BsEvalFrame) string {
+	b := new(strings.Builder)
+	for i, frame := range frames {
+		if i == SHOWN_FRAMES && len(frames) > 2*SHOWN_FRAMES+1 {
+			b.WriteString(fmt.Sprintf("  ... %d more ...\n", len(frames)-2*SHOWN_FRAMES))
+		}
+		if i >= SHOWN_FRAMES && i < len(frames)-SHOWN_FRAMES {
+			continue
+		}
 		b.WriteString(fmt.Sprintf("  [%d] : %s\n", i, frame.msg))
 	}
 	return b.String()
 }
 
+// digs out the value that was initially thrown, skipping any collected context
+func unwindCause(value BsValue) BsValue {
+	if ctx, ok := value.(BsUnwindCtx); ok {
+		return ctx.init
+	}
+	return value
+}
+
 type BsEvalFrame struct {
 	node Ast
 	msg  string
@@ -130,6 +228,9 @@ func (node AstFunCall) Eval(env *BsEnv) BsValue {
 	if out.ShouldUnwind() {
 		return env.addFrame(out, node, "Encountered a failure while invoking a function")
 	}
+	if failure := env.program.budget.made(out); failure != nil {
+		return env.addFrame(failure, node, "while taking what the procedure gave back")
+	}
 	return out
 }
 func (node AstIdent) Eval(env *BsEnv) BsValue {
@@ -160,7 +261,9 @@ func (node AstAssign) Eval(env *BsEnv) BsValue {
 	if rvalue.ShouldUnwind() {
 		return env.addFrame(rvalue, node, "Encountered failure evaluating right side of expression")
 	}
-	env.AssignName(lvalue.name, rvalue)
+	if failure := env.bind(lvalue.name, rvalue); failure != nil {
+		return env.addFrame(failure, node, "while giving '%s' a value", lvalue.name)
+	}
 	return BsNilVal{}
 }
 func (node AstIfStmnt) Eval(env *BsEnv) BsValue {
@@ -190,6 +293,9 @@ func (node AstLoop) Eval(env *BsEnv) BsValue {
 	}
 
 	for {
+		if stop := env.program.budget.step(); stop != nil {
+			return env.addFrame(stop, node, "while going around the loop")
+		}
 		cond := node.cond.Eval(env)
 		if cond.ShouldUnwind() {
 			return env.addFrame(cond, node, "Encountered failure evaluating condition of loop")
@@ -240,20 +346,36 @@ func (node AstFuncDef) Eval(env *BsEnv) BsValue {
 		body:   node.body}
 	// todo: hoisting the name
 	val := BsFunVal{thunk}
-	env.AssignName(node.name.name, val)
+	if failure := env.bind(node.name.name, val); failure != nil {
+		return env.addFrame(failure, node, "while defining '%s'", node.name.name)
+	}
 	return BsNilVal{}
 }
 
 func (v BsRuntimeFunc) Call(callerEnv *BsEnv, args []BsValue) BsValue {
+	if stop := callerEnv.program.budget.step(); stop != nil {
+		return stop
+	}
 	if len(args) != len(v.params) {
 		return BsMethodErr{expected: fmt.Sprintf("need %d arguments, got %d", len(v.params), len(args))}
 	}
 	// each invocarion gets a fresh state
 	invocationEnv := v.env.NewChild()
+	defer invocationEnv.program.budget.release(invocationEnv)
 	// instantiate the parameters
 	for i, param := range v.params {
 		arg := args[i]
-		invocationEnv.AssignName(param.name, arg)
+		if failure := invocationEnv.bind(param.name, arg); failure != nil {
+			return failure
+		}
+	}
+	if stop := invocationEnv.program.budget.enter(v.name); stop != nil {
+		return stop
+	}
+	defer invocationEnv.program.budget.leave()
+	if hook := invocationEnv.program.hook; hook != nil {
+		hook.Enter(invocationEnv, v)
+		defer hook.Leave(invocationEnv, v)
 	}
 	out := EvalAll(invocationEnv, v.body)
 	// catch early returns here
@@ -285,7 +407,18 @@ func EvalAll(env *BsEnv, ast []Ast) BsValue {
 	}
 	var out BsValue = BsNilVal{}
 	for _, node := range ast {
+		if stop := env.program.budget.step(); stop != nil {
+			return stop
+		}
+		if env.program.hook != nil {
+			if stop := env.program.hook.Statement(env, node); stop != nil {
+				return stop
+			}
+		}
 		out = node.Eval(env)
+		if env.program.hook != nil {
+			env.program.hook.Evaluated(env, node, out)
+		}
 		if out.ShouldUnwind() {
 			return out
 		}
@@ -295,6 +428,28 @@ func EvalAll(env *BsEnv, ast []Ast) BsValue {
 
 // casting utilities
 
+// the name we use when talking to people about the type of a value
+func bsTypeName(value BsValue) string {
+	switch value.(type) {
+	case BsBooleVal:
+		return "boole"
+	case BsIntVal:
+		return "number"
+	case BsStrVal:
+		return "text"
+	case BsListVal:
+		return "list"
+	case BsFunVal:
+		return "procedure"
+	case BsNilVal, *BsNilVal:
+		return "nothing"
+	}
+	if value.ShouldUnwind() {
+		return "failure"
+	}
+	return "something"
+}
+
 // truthyness evaluation
 func bsTruthy(value BsValue) bool {
 	switch v := value.(type) {
@@ -304,6 +459,8 @@ func bsTruthy(value BsValue) bool {
 		return v.value > 0 // note: purposefully annoying, negatives are falsey
 	case BsStrVal:
 		return len(v.value) > 0
+	case BsListVal:
+		return len(v.items) > 0
 	case BsNilVal:
 		return false
 	}
@@ -0,0 +1,47 @@
+package boomslang
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// The standard library: procedures written in boomslang itself, in stdlib/*.bs.
+// They are baked into the binary and run in the same scope as the builtins,
+// so anybody who can write boomslang can add to them
+
+//go:embed stdlib/*.bs
+var stdlibFiles embed.FS
+
+var stdlib struct {
+	once sync.Once
+	ast  [][]Ast // one program per file, parsed the first time a program needs them
+}
+
+func loadStdlib(library *BsEnv) {
+	stdlib.once.Do(func() {
+		entries, err := stdlibFiles.ReadDir("stdlib")
+		if err != nil {
+			panic(err)
+		}
+		for _, entry := range entries {
+			path := "stdlib/" + entry.Name()
+			text, err := stdlibFiles.ReadFile(path)
+			if err != nil {
+				panic(err)
+			}
+			ast, err := parseSource(new(Opts), FileSource{"<" + path + ">", bufio.NewReader(strings.NewReader(string(text)))})
+			if err != nil {
+				panic(fmt.Sprintf("the standard library does not parse: %v", err))
+			}
+			stdlib.ast = append(stdlib.ast, ast)
+		}
+	})
+	for _, ast := range stdlib.ast {
+		if out := EvalAll(library, ast); out.ShouldUnwind() {
+			panic(fmt.Sprintf("the standard library failed to load: %s", out.PrettyPrint()))
+		}
+	}
+}
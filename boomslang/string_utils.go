@@ -0,0 +1,56 @@
+package boomslang
+
+import (
+	"strings"
+	"unicode"
+)
+
+type indentlevel struct {
+	tabs   int
+	spaces int
+}
+
+func TrimIndent(s string) (string, indentlevel) {
+	count := indentlevel{}
+	for {
+		if strings.HasPrefix(s, "\t") {
+			s = strings.TrimPrefix(s, "\t")
+			count.tabs += 1
+		} else if strings.HasPrefix(s, " ") {
+			s = strings.TrimPrefix(s, " ")
+			count.spaces += 1
+		} else {
+			break
+		}
+	}
+	return strings.TrimSpace(s), count
+}
+func FirstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return 0
+}
+
+// like strings.Fields, but also tells where each field starts
+func FieldsWithOffsets(s string) ([]string, []int) {
+	fields := make([]string, 0, 8)
+	offsets := make([]int, 0, 8)
+	start := -1
+	for i, r := range s {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				fields = append(fields, s[start:i])
+				offsets = append(offsets, start)
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		fields = append(fields, s[start:])
+		offsets = append(offsets, start)
+	}
+	return fields, offsets
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package boomslang
+
+import "errors"
+
+// line editing is only supported on linux terminals for now,
+// everywhere else the repl reads plain lines
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
@@ -0,0 +1,133 @@
+package boomslang
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Tracing: one record for every statement that finished running,
+// written as text for people or as json lines for tools. Records come out
+// when a statement is done, so the statements inside of a block come before the block itself
+
+const (
+	TRACE_TEXT string = "text"
+	TRACE_JSON string = "json"
+)
+
+// Lines and columns count from 1, the way editors show them.
+// Column is where the statement starts and End the column of its last character
+type traceRecord struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	End    int    `json:"end"`
+	Kind   string `json:"kind"`
+	Value  string `json:"value"`
+	Type   string `json:"type"`
+	Depth  int    `json:"depth"`
+}
+
+func (r traceRecord) String() string {
+	return fmt.Sprintf("%s:%d:%d-%d depth=%d %s => %s (%s)", r.File, r.Line, r.Column, r.End, r.Depth, r.Kind, r.Value, r.Type)
+}
+
+type tracer struct {
+	out    *bufio.Writer
+	format string
+}
+
+func (t *tracer) Statement(env *BsEnv, node Ast) BsValue { return nil }
+func (t *tracer) Enter(env *BsEnv, fun BsRuntimeFunc)    {}
+func (t *tracer) Leave(env *BsEnv, fun BsRuntimeFunc)    {}
+func (t *tracer) Evaluated(env *BsEnv, node Ast, value BsValue) {
+	if isBlank(node) {
+		return
+	}
+	spn := node.Span()
+	// break and returns are how values travel, the value is what they carry
+	value = unwindCause(value)
+	if ret, ok := value.(BsReturnsExc); ok {
+		value = ret.value
+	}
+	record := traceRecord{
+		File:   spn.SourceName,
+		Line:   spn.Lineno,
+		Column: spn.Begin + 1,
+		End:    spn.End, // spans end just after the last character, and count from 0
+		Kind:   astKind(node),
+		Value:  value.PrettyPrint(),
+		Type:   bsTypeName(value),
+		Depth:  scopeDepth(env),
+	}
+	if t.format == TRACE_JSON {
+		line, err := json.Marshal(record)
+		if err != nil {
+			panic(err)
+		}
+		t.out.Write(line)
+		t.out.WriteString("\n")
+	} else {
+		t.out.WriteString(record.String() + "\n")
+	}
+}
+
+// starts tracing into env when opts ask for it, the returned function finishes the trace
+func attachTrace(opts *Opts, env *BsEnv) (func(), error) {
+	if opts.trace == "" {
+		return func() {}, nil
+	}
+	var file io.Writer = opts.estr
+	closeFile := func() error { return nil }
+	if opts.trace != "-" {
+		f, err := os.Create(opts.trace)
+		if err != nil {
+			return nil, err
+		}
+		file, closeFile = f, f.Close
+	}
+	t := &tracer{out: bufio.NewWriter(file), format: opts.traceFormat}
+	env.program.hook = t
+	return func() {
+		t.out.Flush()
+		closeFile()
+	}, nil
+}
+
+// what kind of statement it was, in words that stay the same between versions
+func astKind(node Ast) string {
+	switch node.(type) {
+	case AstFunCall:
+		return "call"
+	case AstIdent:
+		return "name"
+	case AstLiteral:
+		return "literal"
+	case AstAssign:
+		return "assignment"
+	case AstIfStmnt:
+		return "if"
+	case AstLoop:
+		return "loop"
+	case AstBreak:
+		return "break"
+	case AstFuncDef:
+		return "definition"
+	case AstReturns:
+		return "returns"
+	case AstBorrow:
+		return "borrow"
+	}
+	return node.ShortName()
+}
+
+// how many scopes there are around env, the global one is 0
+func scopeDepth(env *BsEnv) int {
+	depth := 0
+	for scope := env.parent; scope != nil && !scope.library; scope = scope.parent {
+		depth += 1
+	}
+	return depth
+}
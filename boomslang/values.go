@@ -1,7 +1,8 @@
-package main
+package boomslang
 
 import (
 	"fmt"
+	"strings"
 )
 
 type BsValue interface {
@@ -54,6 +55,26 @@ func (v BsIntVal) PrettyPrint() string {
 	return fmt.Sprintf("%d", v.value)
 }
 
+type BsListVal struct {
+	items []BsValue
+}
+
+func (v BsListVal) ShouldUnwind() bool {
+	return false
+}
+func (v BsListVal) PrettyPrint() string {
+	b := new(strings.Builder)
+	b.WriteString("[")
+	for i, item := range v.items {
+		if i != 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(item.PrettyPrint())
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
 type BsFunVal struct {
 	thunk BsFunThunk
 }
@@ -89,13 +110,17 @@ func (v BsRuntimeFunc) PrettyPrint() string {
 //
 //	name errors
 type BsNameErr struct {
-	name string
+	name     string
+	withheld Capability // what the builtin by this name needs, when the program is not allowed it
 }
 
 func (v BsNameErr) ShouldUnwind() bool {
 	return true
 }
 func (v BsNameErr) PrettyPrint() string {
+	if v.withheld != 0 {
+		return fmt.Sprintf("Sorry, but %s.", withheldByPolicy("'"+v.name+"'", v.withheld))
+	}
 	return fmt.Sprintf("Sorry, I tried and failed to find the name '%s' in the place you requested it.", v.name)
 }
 
@@ -157,6 +182,85 @@ func (v BsIoErr) PrettyPrint() string {
 	return fmt.Sprintf("(IoError) Sorry, but something happened with the file system: %s", v.msg)
 }
 
+// ====================================
+//  import errors
+
+type BsImportErr struct {
+	path string
+	msg  string
+}
+
+func (v BsImportErr) ShouldUnwind() bool {
+	return true
+}
+func (v BsImportErr) PrettyPrint() string {
+	return fmt.Sprintf("(ImportError) Sorry, but I could not borrow from '%s': %s", v.path, v.msg)
+}
+
+// ====================================
+//  host errors - builtins from the program embedding us that failed
+
+type BsHostErr struct {
+	name string
+	msg  string
+}
+
+func (v BsHostErr) ShouldUnwind() bool {
+	return true
+}
+func (v BsHostErr) PrettyPrint() string {
+	return fmt.Sprintf("(HostError) Sorry, but '%s' could not do what you asked: %s", v.name, v.msg)
+}
+
+// ====================================
+//  timeout errors - the program was stopped before it was done
+
+type BsTimeoutErr struct {
+	msg   string
+	cause error // the error of the context that stopped it, if one did
+}
+
+func (v BsTimeoutErr) ShouldUnwind() bool {
+	return true
+}
+func (v BsTimeoutErr) PrettyPrint() string {
+	return fmt.Sprintf("(TimeoutError) Sorry, but I had to stop your program: %s", v.msg)
+}
+
+// ====================================
+//  resource errors - a program that wants too much memory
+
+type BsResourceErr struct {
+	msg string
+}
+
+func (v BsResourceErr) ShouldUnwind() bool {
+	return true
+}
+func (v BsResourceErr) PrettyPrint() string {
+	return fmt.Sprintf("(ResourceError) Sorry, but your program wanted more than it is allowed: %s", v.msg)
+}
+
+// ====================================
+//  recursion errors - procedures calling each other too deep
+
+type BsRecursionErr struct {
+	depth  int
+	frames []string // the innermost calls, innermost first
+}
+
+func (v BsRecursionErr) ShouldUnwind() bool {
+	return true
+}
+func (v BsRecursionErr) PrettyPrint() string {
+	b := new(strings.Builder)
+	b.WriteString(fmt.Sprintf("(RecursionError) Sorry, but your procedures called each other more than %d deep. The last ones were:", v.depth))
+	for _, frame := range v.frames {
+		b.WriteString("\n    " + frame)
+	}
+	return b.String()
+}
+
 // ====================================
 //  break exception - used for breaking out loops
 
@@ -183,3 +287,17 @@ func (v BsReturnsExc) ShouldUnwind() bool {
 func (v BsReturnsExc) PrettyPrint() string {
 	return fmt.Sprintf("(Internal Exception) returns from proc")
 }
+
+// ====================================
+//  exit exception - used for leaving the program early
+
+type BsExitExc struct {
+	code int
+}
+
+func (v BsExitExc) ShouldUnwind() bool {
+	return true
+}
+func (v BsExitExc) PrettyPrint() string {
+	return fmt.Sprintf("(Internal Exception) exit with status %d", v.code)
+}
@@ -0,0 +1,200 @@
+package boomslang
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Wrapping plain Go functions into builtins, so a new builtin does not need a type of its own.
+// Parameters can be bools, whole numbers, strings, slices of those, any or BsValue,
+// and a first *BsEnv parameter gets the scope the procedure was called from.
+// A function can give back nothing, a value, an error or a value and an error,
+// and when it panics the program gets a HostError instead
+
+var (
+	envType   = reflect.TypeOf((*BsEnv)(nil))
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	valueType = reflect.TypeOf((*BsValue)(nil)).Elem()
+)
+
+type BsWrappedFunc struct {
+	name    string
+	fn      reflect.Value
+	wantEnv bool
+}
+
+// Turns fn into a procedure, failing for functions with parameters or results it can not handle
+func WrapFunc(name string, fn any) (BsFunVal, error) {
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		return BsFunVal{}, fmt.Errorf("'%s' needs a function, not a %T", name, fn)
+	}
+	t := rv.Type()
+	wrapped := BsWrappedFunc{name: name, fn: rv, wantEnv: t.NumIn() > 0 && t.In(0) == envType}
+	for i := wrapped.firstArg(); i < t.NumIn(); i += 1 {
+		param := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			param = param.Elem()
+		}
+		if !convertible(param) {
+			return BsFunVal{}, fmt.Errorf("'%s' has a parameter of type %s, which boomslang can not give it", name, param)
+		}
+	}
+	switch {
+	case t.NumOut() > 2,
+		t.NumOut() == 2 && t.Out(1) != errorType,
+		t.NumOut() == 2 && t.Out(0) == errorType:
+		return BsFunVal{}, fmt.Errorf("'%s' has to give back nothing, a value, an error or a value and an error", name)
+	}
+	return BsFunVal{thunk: wrapped}, nil
+}
+
+// like WrapFunc, for the builtins of the language itself that are known to be fine
+func MustWrapFunc(name string, fn any) BsFunVal {
+	fun, err := WrapFunc(name, fn)
+	if err != nil {
+		panic(err)
+	}
+	return fun
+}
+
+func convertible(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.Slice:
+		return convertible(t.Elem())
+	case reflect.Interface:
+		return t.NumMethod() == 0 || t == valueType
+	}
+	return false
+}
+
+func (this BsWrappedFunc) firstArg() int {
+	if this.wantEnv {
+		return 1
+	}
+	return 0
+}
+
+func (this BsWrappedFunc) PrettyPrint() string {
+	return fmt.Sprintf("<builtin procedure '%s'>", this.name)
+}
+
+func (this BsWrappedFunc) Call(env *BsEnv, args []BsValue) (result BsValue) {
+	// a builtin that panics fails the program that called it, not the one embedding us
+	defer func() {
+		if r := recover(); r != nil {
+			result = BsHostErr{name: this.name, msg: fmt.Sprintf("it panicked: %v", r)}
+		}
+	}()
+	t := this.fn.Type()
+	params := t.NumIn() - this.firstArg()
+	if t.IsVariadic() && len(args) < params-1 {
+		return BsMethodErr{expected: fmt.Sprintf("at least %d parameters to %s, got %d", params-1, this.PrettyPrint(), len(args))}
+	} else if !t.IsVariadic() && len(args) != params {
+		return BsMethodErr{expected: fmt.Sprintf("%d parameters to %s, got %d", params, this.PrettyPrint(), len(args))}
+	}
+
+	in := make([]reflect.Value, 0, len(args)+1)
+	if this.wantEnv {
+		in = append(in, reflect.ValueOf(env))
+	}
+	for i, arg := range args {
+		var param reflect.Type
+		if at := i + this.firstArg(); t.IsVariadic() && at >= t.NumIn()-1 {
+			param = t.In(t.NumIn() - 1).Elem()
+		} else {
+			param = t.In(at)
+		}
+		converted, failure := fromBsValue(param, arg)
+		if failure != nil {
+			return failure
+		}
+		in = append(in, converted)
+	}
+
+	out := this.fn.Call(in)
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			return BsHostErr{name: this.name, msg: err.Error()}
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return BsNilVal{}
+	}
+	value, err := ToValue(out[0].Interface())
+	if err != nil {
+		return BsHostErr{name: this.name, msg: err.Error()}
+	}
+	return value
+}
+
+// the Go value of type t for a boomslang value, or the failure to hand to the program
+func fromBsValue(t reflect.Type, value BsValue) (reflect.Value, BsValue) {
+	fail := func(expected string) (reflect.Value, BsValue) {
+		return reflect.Value{}, BsTypeErr{expected: expected, value: value}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		v, ok := value.(BsBooleVal)
+		if !ok {
+			return fail("boole")
+		}
+		return reflect.ValueOf(v.value).Convert(t), nil
+	case reflect.String:
+		v, ok := value.(BsStrVal)
+		if !ok {
+			return fail("text")
+		}
+		return reflect.ValueOf(v.value).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, ok := value.(BsIntVal)
+		if !ok {
+			return fail("number")
+		}
+		out := reflect.New(t).Elem()
+		if out.OverflowInt(v.value) {
+			return fail(fmt.Sprintf("number for a %s", t))
+		}
+		out.SetInt(v.value)
+		return out, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, ok := value.(BsIntVal)
+		if !ok {
+			return fail("number")
+		}
+		out := reflect.New(t).Elem()
+		if v.value < 0 || out.OverflowUint(uint64(v.value)) {
+			return fail(fmt.Sprintf("number for a %s", t))
+		}
+		out.SetUint(uint64(v.value))
+		return out, nil
+	case reflect.Slice:
+		v, ok := value.(BsListVal)
+		if !ok {
+			return fail("list")
+		}
+		out := reflect.MakeSlice(t, len(v.items), len(v.items))
+		for i, item := range v.items {
+			converted, failure := fromBsValue(t.Elem(), item)
+			if failure != nil {
+				return reflect.Value{}, failure
+			}
+			out.Index(i).Set(converted)
+		}
+		return out, nil
+	case reflect.Interface:
+		out := reflect.New(t).Elem()
+		if t == valueType {
+			out.Set(reflect.ValueOf(value))
+		} else if converted := FromValue(value); converted != nil {
+			out.Set(reflect.ValueOf(converted))
+		}
+		return out, nil
+	}
+	return fail(t.String())
+}
@@ -2,4 +2,4 @@ module boomslang-go/main
 
 go 1.24.1
 
-require github.com/davecgh/go-spew v1.1.1 // indirect
+require github.com/davecgh/go-spew v1.1.1
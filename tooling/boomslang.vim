@@ -14,6 +14,7 @@ syntax match bsKeyword /break/
 syntax match bsKeyword /by/
 syntax match bsKeyword /we[ ]+mean/
 syntax match bsKeyword /returns/
+syntax match bsKeyword /borrow/
 " syntax match bsKeyword /text/
 
 syntax match bsBuiltin /show/
@@ -26,8 +27,39 @@ syntax match bsBuiltin /biggerthan/
 syntax match bsBuiltin /smallerthan/
 syntax match bsBuiltin /equals/
 syntax match bsBuiltin /notequals/
+syntax match bsBuiltin /environment/
+syntax match bsBuiltin /exit/
+syntax match bsBuiltin /first/
+syntax match bsBuiltin /rest/
+syntax match bsBuiltin /length/
+syntax match bsBuiltin /characters/
+syntax match bsBuiltin /together/
+syntax match bsBuiltin /contents/
+syntax match bsBuiltin /lines/
+syntax match bsBuiltin /write/
+syntax match bsBuiltin /append/
+syntax match bsBuiltin /exists/
+syntax match bsBuiltin /files/
+syntax match bsBuiltin /remove/
+syntax match bsBuiltin /random/
+syntax match bsBuiltin /pick/
+syntax match bsBuiltin /shuffle/
+syntax match bsBuiltin /now/
+syntax match bsBuiltin /wait/
+syntax match bsBuiltin /seconds/
+syntax match bsBuiltin /minutes/
+syntax match bsBuiltin /hours/
+syntax match bsBuiltin /days/
+syntax match bsBuiltin /weeks/
+syntax match bsBuiltin /duration/
+syntax match bsBuiltin /format/
+syntax match bsBuiltin /timestamp/
+syntax match bsComment /#.*$/
+syntax match bsPreProc /^\s*#\(include\|define\|if\|otherwise\|end\)\>.*$/
 
 
 hi def link bsText String
 hi def link bsKeyword Keyword
 hi def link bsBuiltin Identifier
+hi def link bsComment Comment
+hi def link bsPreProc PreProc